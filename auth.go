@@ -0,0 +1,116 @@
+package etcdclient
+
+import (
+	"context"
+	"fmt"
+
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	"google.golang.org/grpc/metadata"
+)
+
+// TokenSource supplies pre-issued etcd auth tokens. Token is called again
+// whenever etcd rejects the current token, so implementations should return
+// a freshly issued token rather than a cached one
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// TokenSourceFunc adapts a function to the TokenSource interface
+type TokenSourceFunc func(ctx context.Context) (string, error)
+
+func (f TokenSourceFunc) Token(ctx context.Context) (string, error) {
+	return f(ctx)
+}
+
+// AuthError is returned by store operations when etcd rejects the store's
+// credentials or the authenticated user lacks permission for a key
+type AuthError struct {
+	Err error
+}
+
+func (e *AuthError) Error() string {
+	return fmt.Sprintf("etcd authentication failed: %v", e.Err)
+}
+
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+// WithCredentials authenticates with etcd as the given user. The etcd client
+// fetches a token when connecting and refreshes it when it expires
+func WithCredentials(username, password string) Option {
+	return func(o *options) {
+		o.config.Username = username
+		o.config.Password = password
+	}
+}
+
+// WithTokenSource authenticates every request with a token from ts instead of
+// a username and password
+func WithTokenSource(ts TokenSource) Option {
+	return func(o *options) {
+		o.tokenSource = ts
+	}
+}
+
+// authenticated runs fn with the store's credentials attached to ctx. If etcd
+// rejects the auth token fn is retried once with a refreshed token, and auth
+// failures are returned as an *AuthError
+func (c *store) authenticated(ctx context.Context, fn func(context.Context) error) error {
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		actx, terr := c.authContext(ctx, attempt > 0)
+		if terr != nil {
+			return &AuthError{Err: terr}
+		}
+
+		err = fn(actx)
+		if err == nil {
+			return nil
+		}
+		if rpctypes.Error(err) != rpctypes.ErrInvalidAuthToken {
+			break
+		}
+		c.logger.Debug("etcd rejected auth token, retrying with a refreshed token")
+	}
+
+	if isAuthError(err) {
+		return &AuthError{Err: err}
+	}
+	return err
+}
+
+// authContext attaches the token from the token source, if one is
+// configured, to the outgoing request metadata
+func (c *store) authContext(ctx context.Context, refresh bool) (context.Context, error) {
+	if c.tokenSource == nil {
+		return ctx, nil
+	}
+
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+	if c.token == "" || refresh {
+		token, err := c.tokenSource.Token(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.token = token
+	}
+
+	return metadata.AppendToOutgoingContext(ctx, rpctypes.TokenFieldNameGRPC, c.token), nil
+}
+
+// isAuthError reports whether err is one of the errors etcd returns for
+// failed authentication or authorization
+func isAuthError(err error) bool {
+	switch rpctypes.Error(err) {
+	case rpctypes.ErrAuthFailed,
+		rpctypes.ErrAuthNotEnabled,
+		rpctypes.ErrAuthOldRevision,
+		rpctypes.ErrInvalidAuthToken,
+		rpctypes.ErrPermissionDenied,
+		rpctypes.ErrUserEmpty:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package etcdclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestAuthenticatedRefreshesToken(t *testing.T) {
+	issued := 0
+	c := &store{
+		logger: zap.NewNop(),
+		tokenSource: TokenSourceFunc(func(ctx context.Context) (string, error) {
+			issued++
+			return fmt.Sprintf("token-%d", issued), nil
+		}),
+	}
+
+	seen := []string{}
+	err := c.authenticated(context.Background(), func(ctx context.Context) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		seen = append(seen, md.Get(rpctypes.TokenFieldNameGRPC)...)
+		if len(seen) == 1 {
+			return rpctypes.ErrInvalidAuthToken
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"token-1", "token-2"}, seen)
+
+	// The refreshed token is reused for later requests
+	seen = seen[:0]
+	err = c.authenticated(context.Background(), func(ctx context.Context) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		seen = append(seen, md.Get(rpctypes.TokenFieldNameGRPC)...)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"token-2"}, seen)
+}
+
+func TestAuthenticatedErrors(t *testing.T) {
+	errOther := errors.New("other")
+
+	cases := []struct {
+		name        string
+		tokenSource TokenSource
+		err         error
+		expectedErr error
+		authErr     bool
+	}{
+		{
+			name:        "permission_denied",
+			err:         rpctypes.ErrPermissionDenied,
+			expectedErr: rpctypes.ErrPermissionDenied,
+			authErr:     true,
+		},
+		{
+			name:        "token_still_invalid",
+			err:         rpctypes.ErrInvalidAuthToken,
+			expectedErr: rpctypes.ErrInvalidAuthToken,
+			authErr:     true,
+		},
+		{
+			name: "token_source_failure",
+			tokenSource: TokenSourceFunc(func(ctx context.Context) (string, error) {
+				return "", errOther
+			}),
+			expectedErr: errOther,
+			authErr:     true,
+		},
+		{
+			name:        "not_auth_related",
+			err:         errOther,
+			expectedErr: errOther,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &store{
+				logger:      zap.NewNop(),
+				tokenSource: tc.tokenSource,
+			}
+			err := c.authenticated(context.Background(), func(ctx context.Context) error {
+				return tc.err
+			})
+
+			var authErr *AuthError
+			assert.Equal(t, tc.authErr, errors.As(err, &authErr))
+			assert.True(t, errors.Is(err, tc.expectedErr))
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package etcdclient
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+)
+
+// ErrConflict is returned when a guarded Set did not apply because the keys
+// it writes were changed concurrently
+var ErrConflict = errors.New("conflicting concurrent modification")
+
+// ConflictError lists the fields and keys whose guard failed
+type ConflictError struct {
+	Fields []string
+	Keys   []string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%v for fields %s", ErrConflict, strings.Join(e.Fields, ", "))
+}
+
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// Revisions records the revisions observed by a Get so that a later
+// SetIfUnchanged can detect writes that happened in between
+type Revisions struct {
+	// Revision is the etcd store revision the Get was served at
+	Revision int64
+	// Keys holds the ModRevision of every key read, 0 for keys that did not
+	// exist
+	Keys map[string]int64
+}
+
+// record stores the revisions from the response to the get ops
+func (r *Revisions) record(resp *clientv3.TxnResponse, etcdOps []clientv3.Op) {
+	if r.Keys == nil {
+		r.Keys = map[string]int64{}
+	}
+	r.Revision = resp.Header.Revision
+	for i, op := range etcdOps {
+		rr := resp.Responses[i].GetResponseRange()
+		if len(op.RangeBytes()) == 0 && len(rr.Kvs) == 0 {
+			r.Keys[string(op.KeyBytes())] = 0
+		}
+		for _, kv := range rr.Kvs {
+			r.Keys[string(kv.Key)] = kv.ModRevision
+		}
+	}
+}
+
+// setMode restricts a Set to keys that do or do not exist yet
+type setMode int
+
+const (
+	setUpsert setMode = iota
+	setCreateOnly
+	setUpdateOnly
+)
+
+// guard is a condition on a key or range that a Set checks atomically with
+// its writes
+type guard struct {
+	field string
+	key   string
+	// end is the end of the range for range guards
+	end string
+	cmp clientv3.Cmp
+	// violated reports whether the current key values break the condition
+	violated func(kvs []*mvccpb.KeyValue) bool
+	// reread marks guards on prefixes read while building the ops. Building
+	// the ops again resolves their failure
+	reread bool
+}
+
+// guards returns the conditions requested by the options for the ops of a Set
+func (o *opOptions) guards(etcdOps []clientv3.Op, plan *setPlan) []guard {
+	guards := []guard{}
+	if o.unchanged != nil {
+		guards = append(guards, unchangedGuards(o.unchanged, etcdOps, plan)...)
+	}
+	if o.mode != setUpsert {
+		guards = append(guards, modeGuards(o.mode, etcdOps, plan)...)
+	}
+	return append(guards, plan.readGuards()...)
+}
+
+// readGuards guards the prefixes read while building the ops against any
+// change after they were read
+func (p *setPlan) readGuards() []guard {
+	guards := []guard{}
+	rev := p.readRev
+	for _, r := range p.reads {
+		end := clientv3.GetPrefixRangeEnd(r.prefix)
+		guards = append(guards, guard{
+			field: r.field,
+			key:   r.prefix,
+			end:   end,
+			cmp:   clientv3.Compare(clientv3.ModRevision(r.prefix), "<", rev+1).WithRange(end),
+			violated: func(kvs []*mvccpb.KeyValue) bool {
+				for _, kv := range kvs {
+					if kv.ModRevision > rev {
+						return true
+					}
+				}
+				return false
+			},
+			reread: true,
+		})
+	}
+	return guards
+}
+
+// modeGuards guards every key put by etcdOps to not exist yet for create-only
+// Sets, or to already exist for update-only Sets. Deletes are not guarded
+func modeGuards(mode setMode, etcdOps []clientv3.Op, plan *setPlan) []guard {
+	guards := []guard{}
+	for _, op := range etcdOps {
+		if !op.IsPut() {
+			continue
+		}
+		key := string(op.KeyBytes())
+
+		g := guard{
+			field: plan.fields[key],
+			key:   key,
+		}
+		if mode == setCreateOnly {
+			g.cmp = clientv3.Compare(clientv3.CreateRevision(key), "=", 0)
+			g.violated = func(kvs []*mvccpb.KeyValue) bool {
+				return len(kvs) > 0
+			}
+		} else {
+			g.cmp = clientv3.Compare(clientv3.CreateRevision(key), "!=", 0)
+			g.violated = func(kvs []*mvccpb.KeyValue) bool {
+				return len(kvs) == 0
+			}
+		}
+		guards = append(guards, g)
+	}
+	return guards
+}
+
+// unchangedGuards guards every key written by etcdOps against modification
+// since revs was recorded. Keys read by the Get must still have the same
+// ModRevision, which also detects deletions, and any other key or range must
+// not have been modified after the Get's revision
+func unchangedGuards(revs *Revisions, etcdOps []clientv3.Op, plan *setPlan) []guard {
+	guards := []guard{}
+	seen := map[string]bool{}
+
+	keyGuard := func(field, key string) {
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+
+		if rev, ok := revs.Keys[key]; ok {
+			guards = append(guards, guard{
+				field: field,
+				key:   key,
+				cmp:   clientv3.Compare(clientv3.ModRevision(key), "=", rev),
+				violated: func(kvs []*mvccpb.KeyValue) bool {
+					return modRevision(kvs) != rev
+				},
+			})
+			return
+		}
+		guards = append(guards, guard{
+			field: field,
+			key:   key,
+			cmp:   clientv3.Compare(clientv3.ModRevision(key), "<", revs.Revision+1),
+			violated: func(kvs []*mvccpb.KeyValue) bool {
+				return modRevision(kvs) > revs.Revision
+			},
+		})
+	}
+
+	for _, op := range etcdOps {
+		key, end := string(op.KeyBytes()), string(op.RangeBytes())
+		field := plan.fields[key]
+		if end == "" {
+			keyGuard(field, key)
+			continue
+		}
+
+		guards = append(guards, guard{
+			field: field,
+			key:   key,
+			end:   end,
+			cmp:   clientv3.Compare(clientv3.ModRevision(key), "<", revs.Revision+1).WithRange(end),
+			violated: func(kvs []*mvccpb.KeyValue) bool {
+				for _, kv := range kvs {
+					if kv.ModRevision > revs.Revision {
+						return true
+					}
+				}
+				return false
+			},
+		})
+		// The range guard cannot tell that a key was deleted, so the keys
+		// read within the range are guarded individually
+		for k := range revs.Keys {
+			if k >= key && k < end {
+				keyGuard(field, k)
+			}
+		}
+	}
+
+	// Map iteration above is random, keep the txn deterministic
+	sort.SliceStable(guards, func(i, j int) bool {
+		return guards[i].key < guards[j].key
+	})
+	return guards
+}
+
+// guardOps returns the txn conditions for guards and the else ops that read
+// the guarded keys back when a condition fails
+func guardOps(guards []guard) ([]clientv3.Cmp, []clientv3.Op) {
+	cmps := make([]clientv3.Cmp, 0, len(guards))
+	elseOps := make([]clientv3.Op, 0, len(guards))
+	for _, g := range guards {
+		cmps = append(cmps, g.cmp)
+		opts := []clientv3.OpOption{clientv3.WithKeysOnly()}
+		if g.end != "" {
+			opts = append(opts, clientv3.WithRange(g.end))
+		}
+		elseOps = append(elseOps, clientv3.OpGet(g.key, opts...))
+	}
+	return cmps, elseOps
+}
+
+// conflictError builds the error for a txn whose guards failed from the key
+// values read by the else ops
+func conflictError(guards []guard, resp *clientv3.TxnResponse) error {
+	err := &ConflictError{}
+	seen := map[string]bool{}
+	for i, g := range guards {
+		if i >= len(resp.Responses) || !g.violated(resp.Responses[i].GetResponseRange().Kvs) {
+			continue
+		}
+		err.Keys = append(err.Keys, g.key)
+		if !seen[g.field] {
+			seen[g.field] = true
+			err.Fields = append(err.Fields, g.field)
+		}
+	}
+	return err
+}
+
+// onlyReadsChanged reports whether every failed guard of a txn is a reread
+// guard, so building the ops again may succeed
+func onlyReadsChanged(guards []guard, resp *clientv3.TxnResponse) bool {
+	failed := false
+	for i, g := range guards {
+		if i >= len(resp.Responses) || !g.violated(resp.Responses[i].GetResponseRange().Kvs) {
+			continue
+		}
+		if !g.reread {
+			return false
+		}
+		failed = true
+	}
+	return failed
+}
+
+// modRevision returns the ModRevision of a single key read, 0 if it does not
+// exist
+func modRevision(kvs []*mvccpb.KeyValue) int64 {
+	if len(kvs) == 0 {
+		return 0
+	}
+	return kvs[0].ModRevision
+}
@@ -0,0 +1,147 @@
+package etcdclient
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+)
+
+func TestRevisionsRecord(t *testing.T) {
+	etcdOps := []clientv3.Op{
+		clientv3.OpGet("/path/sub/to/name"),
+		clientv3.OpGet("/path/sub/to/id"),
+		clientv3.OpGet("/path/sub/to/slice/", clientv3.WithPrefix()),
+	}
+	resp := &clientv3.TxnResponse{
+		Header: &etcdserverpb.ResponseHeader{Revision: 10},
+		Responses: []*etcdserverpb.ResponseOp{
+			rangeResponse(&mvccpb.KeyValue{Key: []byte("/path/sub/to/name"), ModRevision: 7}),
+			rangeResponse(),
+			rangeResponse(
+				&mvccpb.KeyValue{Key: []byte("/path/sub/to/slice/a"), ModRevision: 3},
+				&mvccpb.KeyValue{Key: []byte("/path/sub/to/slice/b"), ModRevision: 4},
+			),
+		},
+	}
+
+	revs := &Revisions{}
+	revs.record(resp, etcdOps)
+	assert.Equal(t, &Revisions{
+		Revision: 10,
+		Keys: map[string]int64{
+			"/path/sub/to/name":    7,
+			"/path/sub/to/id":      0,
+			"/path/sub/to/slice/a": 3,
+			"/path/sub/to/slice/b": 4,
+		},
+	}, revs)
+}
+
+func TestUnchangedGuardsConflict(t *testing.T) {
+	revs := &Revisions{
+		Revision: 10,
+		Keys: map[string]int64{
+			"/path/test/sub/to/name":    7,
+			"/path/test/sub/to/slice/a": 3,
+		},
+	}
+	model := TestModel3{
+		Name: SetString("renamed"),
+		IDs:  []*EtcdUuid{DeleteUuid()},
+	}
+
+	plan := newSetPlan(nil, nil)
+	etcdOps, err := createStructSetOps(reflect.ValueOf(model), "TestModel3", map[string]string{"@": "", "var": "sub"}, false, plan)
+	require.NoError(t, err)
+
+	guards := newOpOptions(IfUnchanged(revs)).guards(etcdOps, plan)
+	require.Len(t, guards, 3)
+	cmps, elseOps := guardOps(guards)
+	assert.Len(t, cmps, 3)
+	assert.Len(t, elseOps, 3)
+
+	// The name is untouched but a slice element was deleted
+	resp := &clientv3.TxnResponse{
+		Header: &etcdserverpb.ResponseHeader{Revision: 12},
+		Responses: []*etcdserverpb.ResponseOp{
+			rangeResponse(&mvccpb.KeyValue{Key: []byte("/path/test/sub/to/name"), ModRevision: 7}),
+			rangeResponse(),
+			rangeResponse(),
+		},
+	}
+	err = conflictError(guards, resp)
+	assert.True(t, errors.Is(err, ErrConflict))
+
+	var conflict *ConflictError
+	require.True(t, errors.As(err, &conflict))
+	assert.Equal(t, []string{"TestModel3.IDs"}, conflict.Fields)
+	assert.Equal(t, []string{"/path/test/sub/to/slice/a"}, conflict.Keys)
+}
+
+func TestModeGuardsConflict(t *testing.T) {
+	model := TestModel2Parent{
+		Name:  SetString("test"),
+		ID:    DeleteUuid(),
+		Count: SetUint(42),
+	}
+
+	cases := []struct {
+		name           string
+		opt            OpOption
+		existing       map[string]bool
+		expectedFields []string
+	}{
+		{
+			name: "create_only_absent",
+			opt:  CreateOnly(),
+		},
+		{
+			name:           "create_only_exists",
+			opt:            CreateOnly(),
+			existing:       map[string]bool{"/path/sub/to/count_key": true},
+			expectedFields: []string{"TestModel2Parent.Count"},
+		},
+		{
+			name:     "update_only_exists",
+			opt:      UpdateOnly(),
+			existing: map[string]bool{"/path/sub/to/name": true, "/path/sub/to/count_key": true},
+		},
+		{
+			name:           "update_only_absent",
+			opt:            UpdateOnly(),
+			existing:       map[string]bool{"/path/sub/to/name": true},
+			expectedFields: []string{"TestModel2Parent.Count"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			plan := newSetPlan(nil, nil)
+			etcdOps, err := createStructSetOps(reflect.ValueOf(model), "TestModel2Parent", map[string]string{"@": "", "var": "sub"}, false, plan)
+			require.NoError(t, err)
+
+			// The delete of ID is not guarded
+			guards := newOpOptions(tc.opt).guards(etcdOps, plan)
+			require.Len(t, guards, 2)
+
+			resp := &clientv3.TxnResponse{Header: &etcdserverpb.ResponseHeader{}}
+			for _, g := range guards {
+				if tc.existing[g.key] {
+					resp.Responses = append(resp.Responses, rangeResponse(&mvccpb.KeyValue{Key: []byte(g.key), CreateRevision: 1}))
+				} else {
+					resp.Responses = append(resp.Responses, rangeResponse())
+				}
+			}
+
+			var conflict *ConflictError
+			require.True(t, errors.As(conflictError(guards, resp), &conflict))
+			assert.Equal(t, tc.expectedFields, conflict.Fields)
+		})
+	}
+}
@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"reflect"
 	"strings"
+	"sync"
+	"time"
 
-	"github.com/coreos/etcd/etcdserver/etcdserverpb"
-	"go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
 	"go.uber.org/zap"
 )
 
@@ -20,144 +23,365 @@ var (
 	etcdValueType reflect.Type = reflect.TypeOf((*EtcdValue)(nil)).Elem()
 )
 
-/*
-TODO: improve functionality of client
-1.) Array gets
-2.) Encryption on sets
-3.) Leases
-4.) TLS for etcd client
-*/
-
 type store struct {
 	logger *zap.Logger
 	client *clientv3.Client
+	// ownsClient is false when the client was handed to NewFromClient, in
+	// which case closing the store leaves the connection open
+	ownsClient bool
+	// timeout bounds every request when the caller's context has no
+	// earlier deadline
+	timeout time.Duration
+
+	tokenSource TokenSource
+	tokenMu     sync.Mutex
+	token       string
+
+	// keys supplies the keys of encrypted fields
+	keys KeyProvider
+	// signingKeys, when set, supplies the keys signing every value
+	signingKeys KeyProvider
+	// compression is the algorithm values are compressed with by default
+	compression string
 }
 
 type Store interface {
 	Get(g interface{}, pathvar map[string]string) error
+	GetCtx(ctx context.Context, g interface{}, pathvar map[string]string, opts ...OpOption) error
 	Set(s interface{}, pathvar map[string]string) error
+	SetCtx(ctx context.Context, s interface{}, pathvar map[string]string, opts ...OpOption) error
+	SetWithLeases(ctx context.Context, s interface{}, pathvar map[string]string, opts ...OpOption) ([]*Lease, error)
+	SetElement(ctx context.Context, model interface{}, pathvar map[string]string, field string, id string, elem interface{}, opts ...OpOption) error
+	DeleteElement(ctx context.Context, model interface{}, pathvar map[string]string, field string, id string, opts ...OpOption) error
+	InsertElement(ctx context.Context, model interface{}, pathvar map[string]string, field string, index int, elem interface{}, opts ...OpOption) error
+	MoveElement(ctx context.Context, model interface{}, pathvar map[string]string, field string, from int, to int, opts ...OpOption) error
+	TruncateElements(ctx context.Context, model interface{}, pathvar map[string]string, field string, length int, opts ...OpOption) error
+	SetIfUnchanged(ctx context.Context, s interface{}, pathvar map[string]string, revs *Revisions) error
+	Delete(ctx context.Context, d interface{}, pathvar map[string]string, opts ...OpOption) error
+	Watch(ctx context.Context, model interface{}, pathvar map[string]string) (<-chan WatchEvent, error)
 	Close() error
 }
 
-// NewEtcdStore initializes a connection to etcd based on a passed in configuration
+// New initializes a connection to etcd configured by the passed in options
 // Note: it is up to the initializer to close the store to not leak connections
-func NewEtcdStore(conf *config.GlobalConfig, logger *zap.Logger) (Store, error) {
-	if conf == nil || conf.Etcd == nil {
-		return nil, fmt.Errorf("cannot pass in nil etcd configuration")
+func New(opts ...Option) (Store, error) {
+	o := newOptions(opts...)
+	if len(o.config.Endpoints) == 0 {
+		return nil, fmt.Errorf("cannot create store without etcd endpoints")
+	}
+	if o.compression != "" {
+		if err := checkCompression(o.compression); err != nil {
+			return nil, err
+		}
 	}
-	if logger == nil {
-		logger = config.GetLogger()
+	if o.tls != nil {
+		tlsConf, err := o.tls.build()
+		if err != nil {
+			o.logger.Error("error loading etcd TLS configuration", zap.Error(err))
+			return nil, err
+		}
+		o.config.TLS = tlsConf
 	}
 
-	c, err := clientv3.New(clientv3.Config{
-		Endpoints: conf.Etcd.Endpoints,
-	})
+	c, err := clientv3.New(o.config)
 	if err != nil {
-		logger.Error("error initializing etcd client", zap.Error(err))
+		o.logger.Error("error initializing etcd client", zap.Error(err))
+		if isAuthError(err) {
+			return nil, &AuthError{Err: err}
+		}
 		return nil, err
 	}
 
 	return &store{
-		client: c,
-		logger: logger,
+		client:      c,
+		logger:      o.logger,
+		ownsClient:  true,
+		timeout:     o.timeout,
+		tokenSource: o.tokenSource,
+		keys:        o.keys,
+		signingKeys: o.signingKeys,
+		compression: o.compression,
+	}, nil
+}
+
+// NewFromClient wraps an existing etcd client in a store. Options that
+// configure the connection are ignored, and closing the store does not close
+// the client, so it can be shared with the rest of the service
+func NewFromClient(client *clientv3.Client, opts ...Option) (Store, error) {
+	if client == nil {
+		return nil, fmt.Errorf("cannot pass in nil etcd client")
+	}
+	o := newOptions(opts...)
+	if o.compression != "" {
+		if err := checkCompression(o.compression); err != nil {
+			return nil, err
+		}
+	}
+
+	return &store{
+		client:      client,
+		logger:      o.logger,
+		timeout:     o.timeout,
+		tokenSource: o.tokenSource,
+		keys:        o.keys,
+		signingKeys: o.signingKeys,
+		compression: o.compression,
 	}, nil
 }
 
+// Get reads the fields of g requested with the Get sentinels
 func (c *store) Get(g interface{}, pathvar map[string]string) error {
+	return c.GetCtx(context.Background(), g, pathvar)
+}
+
+// GetCtx is Get bounded by ctx
+func (c *store) GetCtx(ctx context.Context, g interface{}, pathvar map[string]string, opts ...OpOption) error {
 	// Get the reflected value
 	value := reflect.ValueOf(g)
 	// Verify that the value is a pointer
 	if value.Kind() != reflect.Ptr {
-		err := fmt.Errorf("Provided interface is not a pointer")
+		err := &Error{Kind: ErrInvalidModel, Err: fmt.Errorf("Provided interface is not a pointer")}
 		c.logger.Error("Error validating interface", zap.Error(err))
 		return err
 	}
 	// Verify the pointer points to a struct
 	value = value.Elem()
 	if value.Kind() != reflect.Struct {
-		err := fmt.Errorf("Provided interface is does not reference a struct")
+		err := &Error{Kind: ErrInvalidModel, Err: fmt.Errorf("Provided interface is does not reference a struct")}
 		c.logger.Error("Error validating interface", zap.Error(err))
 		return err
 	}
 
 	pathvar["@"] = ""
 
-	etcdOps, callbacks, err := createStructGetOps(value, pathvar, false)
+	o := newOpOptions(opts...)
+	plan := &getPlan{ctx: ctx, store: c, meta: o.metadata, mask: newFieldMask(o.fields)}
+	if err := plan.mask.check(value.Type()); err != nil {
+		c.logger.Error("Error validating fields", zap.Error(err))
+		return err
+	}
+	etcdOps, callbacks, err := createStructGetOps(value, value.Type().Name(), pathvar, false, plan)
 	if err != nil {
 		c.logger.Error("Error generating ops", zap.Error(err))
 		return err
 	}
 
-	txn := c.client.Txn(context.Background()).If().Then(etcdOps...)
-	resp, err := txn.Commit()
+	ctx, cancel := c.requestContext(ctx)
+	defer cancel()
+
+	var resp *clientv3.TxnResponse
+	err = c.authenticated(ctx, func(ctx context.Context) error {
+		resp, err = c.client.Txn(ctx).If().Then(etcdOps...).Commit()
+		return err
+	})
 	if err != nil {
 		c.logger.Error("Error performing ops", zap.Error(err))
-		return err
+		return txnError(err)
 	}
 
 	if len(resp.Responses) != len(callbacks) {
-		err = fmt.Errorf("Unexpected number of responses")
+		err = &Error{Kind: ErrTxnFailed, Err: fmt.Errorf("Unexpected number of responses")}
 		c.logger.Error("Invalid etcd response", zap.Error(err))
 		return err
 	}
 
 	for i, r := range resp.Responses {
 		if err = callbacks[i](r); err != nil {
-			err = fmt.Errorf("Invalid data for field type")
 			c.logger.Error("Error parsing etcd response", zap.Error(err))
 			return err
 		}
 	}
 
+	if o.revisions != nil {
+		o.revisions.record(resp, etcdOps)
+	}
+
 	return nil
 }
 
-func createStructGetOps(value reflect.Value, pathvar map[string]string, inslice bool) ([]clientv3.Op, []func(*etcdserverpb.ResponseOp) error, error) {
+// getPlan holds the state shared by the op builders and callbacks of a single
+// Get call
+type getPlan struct {
+	ctx   context.Context
+	store *store
+	// meta receives the metadata of every decoded field when requested
+	meta Metadata
+	// mask selects the fields read instead of the Get sentinels when set
+	mask *fieldMask
+}
+
+// fieldMask returns the mask of the Get, nil when the sentinels select the
+// fields read
+func (p *getPlan) fieldMask() *fieldMask {
+	if p == nil {
+		return nil
+	}
+	return p.mask
+}
+
+// decode converts a value read for a field with tagOpts to the data its
+// type decodes
+func (p *getPlan) decode(tagOpts tagOptions, kv *mvccpb.KeyValue) (string, error) {
+	ctx, s := context.Background(), &store{}
+	if p != nil && p.store != nil {
+		ctx, s = p.ctx, p.store
+	}
+
+	data := string(kv.Value)
+	var err error
+	if s.signingKeys != nil {
+		if data, err = verifyValue(ctx, s.signingKeys, string(kv.Key), data); err != nil {
+			return "", err
+		}
+	}
+	if tagOpts.encrypt {
+		if data, err = decryptValue(ctx, s.keys, data); err != nil {
+			return "", err
+		}
+	}
+	if data, err = decompressValue(data); err != nil {
+		return "", err
+	}
+	return tagOpts.decode(data)
+}
+
+// recordMeta stores the metadata of the key decoded into field, or removes
+// the field's entry when the key does not exist
+func (p *getPlan) recordMeta(field string, kv *mvccpb.KeyValue) {
+	if p == nil || p.meta == nil {
+		return
+	}
+	if kv == nil {
+		delete(p.meta, field)
+		return
+	}
+	p.meta[field] = KeyMetadata{
+		Key:            string(kv.Key),
+		CreateRevision: kv.CreateRevision,
+		ModRevision:    kv.ModRevision,
+		Version:        kv.Version,
+		Lease:          clientv3.LeaseID(kv.Lease),
+	}
+}
+
+// clearMeta removes the entries of the fields starting with prefix
+func (p *getPlan) clearMeta(prefix string) {
+	if p == nil {
+		return
+	}
+	for field := range p.meta {
+		if strings.HasPrefix(field, prefix) {
+			delete(p.meta, field)
+		}
+	}
+}
+
+// createStructGetOps builds the get ops for the tagged fields of value and
+// the callbacks that decode each response into its field. fieldPath is the Go
+// path of value used to identify fields in errors
+func createStructGetOps(value reflect.Value, fieldPath string, pathvar map[string]string, inslice bool, plan *getPlan) ([]clientv3.Op, []func(*etcdserverpb.ResponseOp) error, error) {
 	etcdOps := []clientv3.Op{}
 	callbacks := []func(*etcdserverpb.ResponseOp) error{}
 
 	for i := 0; i < value.NumField(); i++ {
 		field := value.Field(i)
+		fieldName := fieldPath + "." + value.Type().Field(i).Name
 		// If the struct field has not path tag it will be ignored
 		tag, ok := value.Type().Field(i).Tag.Lookup(tagKey)
 		if !ok {
 			continue
 		}
 
-		etcdKey, err := pathReplace(tag, pathvar, inslice)
+		path, tagOpts, err := parseTag(tag)
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, withField(err, fieldName)
+		}
+		etcdKey, err := pathReplace(path, pathvar, inslice)
+		if err != nil {
+			return nil, nil, withField(err, fieldName)
+		}
+
+		// Without a mask the sentinels select the values read and plain
+		// fields are always read
+		selected := true
+		if mask := plan.fieldMask(); mask != nil {
+			var below bool
+			selected, below = mask.match(fieldName)
+			if !selected && !below {
+				continue
+			}
 		}
 
-		if field.Kind() == reflect.Ptr && field.Type().Implements(etcdValueType) && field.Interface().(EtcdValue).IsGet() {
+		if field.Kind() == reflect.Ptr && field.Type().Implements(etcdValueType) {
+			if !selected || plan.fieldMask() == nil && !field.Interface().(EtcdValue).IsGet() {
+				continue
+			}
 			etcdOps = append(etcdOps, clientv3.OpGet(etcdKey))
 			callbacks = append(callbacks, func(resp *etcdserverpb.ResponseOp) error {
-				val := reflect.New(field.Elem().Type())
+				val := reflect.New(field.Type().Elem())
 				field.Set(val)
 				iface, ok := val.Interface().(EtcdValue)
 				if !ok {
-					err = fmt.Errorf("Interface does not implement EtcdValue")
-					return err
+					return &Error{Kind: ErrInvalidModel, Field: fieldName, Key: etcdKey, Err: fmt.Errorf("Interface does not implement EtcdValue")}
 				}
 
 				if len(resp.GetResponseRange().Kvs) <= 0 {
 					field.Set(reflect.Zero(field.Type()))
+					plan.recordMeta(fieldName, nil)
+					return nil
+				}
+				kv := resp.GetResponseRange().Kvs[0]
+				data, err := plan.decode(tagOpts, kv)
+				if err == nil {
+					err = iface.FromString(data)
+				}
+				if err != nil {
+					return &Error{Kind: ErrDecode, Field: fieldName, Key: etcdKey, Err: err}
+				}
+				plan.recordMeta(fieldName, kv)
+				return nil
+			})
+		} else if codec := plainCodec(field.Type()); codec != nil {
+			if !selected {
+				continue
+			}
+			etcdOps = append(etcdOps, clientv3.OpGet(etcdKey))
+			callbacks = append(callbacks, func(resp *etcdserverpb.ResponseOp) error {
+				if len(resp.GetResponseRange().Kvs) <= 0 {
+					field.Set(reflect.Zero(field.Type()))
+					plan.recordMeta(fieldName, nil)
 					return nil
 				}
-				etcdVal := resp.GetResponseRange().Kvs[0].Value
-				return iface.FromString(string(etcdVal))
+				kv := resp.GetResponseRange().Kvs[0]
+				data, err := plan.decode(tagOpts, kv)
+				if err == nil {
+					err = decodeValue(codec, data, field)
+				}
+				if err != nil {
+					return &Error{Kind: ErrDecode, Field: fieldName, Key: etcdKey, Err: err}
+				}
+				plan.recordMeta(fieldName, kv)
+				return nil
 			})
 		} else if field.Kind() == reflect.Struct {
+			parent := pathvar["@"]
 			pathvar["@"] = etcdKey
-			newOps, newCallbacks, err := createStructGetOps(field, pathvar, inslice)
+			newOps, newCallbacks, err := createStructGetOps(field, fieldName, pathvar, inslice, plan)
+			pathvar["@"] = parent
 			if err != nil {
 				return nil, nil, err
 			}
 			etcdOps = append(etcdOps, newOps...)
 			callbacks = append(callbacks, newCallbacks...)
 		} else if field.Kind() == reflect.Slice {
-			pathvar["@"] = etcdKey
-			newOps, newCallbacks, err := createSliceGetOps(field, etcdKey, true)
+			newOps, newCallbacks, err := createSliceGetOps(field, fieldName, etcdKey, tagOpts, pathvar, true, plan)
+			if err != nil {
+				return nil, nil, err
+			}
+			etcdOps = append(etcdOps, newOps...)
+			callbacks = append(callbacks, newCallbacks...)
+		} else if field.Kind() == reflect.Map {
+			newOps, newCallbacks, err := createMapGetOps(field, fieldName, etcdKey, tagOpts, pathvar, plan)
 			if err != nil {
 				return nil, nil, err
 			}
@@ -169,128 +393,439 @@ func createStructGetOps(value reflect.Value, pathvar map[string]string, inslice
 	return etcdOps, callbacks, nil
 }
 
-func createSliceGetOps(value reflect.Value, etcdKey string, inslice bool) ([]clientv3.Op, []func(*etcdserverpb.ResponseOp) error, error) {
+func createSliceGetOps(value reflect.Value, fieldPath string, etcdKey string, tagOpts tagOptions, pathvar map[string]string, inslice bool, plan *getPlan) ([]clientv3.Op, []func(*etcdserverpb.ResponseOp) error, error) {
 	etcdOps := []clientv3.Op{}
 	callbacks := []func(*etcdserverpb.ResponseOp) error{}
 
+	// With a mask the elements are read into zero values, and the mask
+	// selects their fields
+	if mask := plan.fieldMask(); mask != nil {
+		if isStructSlice(value.Type()) {
+			return createStructSliceGetOps(value, newElement(value.Type().Elem()), fieldPath, etcdKey, pathvar, plan)
+		}
+		if selected, _ := mask.match(fieldPath); !selected {
+			return etcdOps, callbacks, nil
+		}
+		if !value.Type().Elem().Implements(etcdValueType) {
+			return nil, nil, &Error{Kind: ErrInvalidModel, Field: fieldPath, Key: etcdKey, Err: fmt.Errorf("Slice must be of *EtcdValue or struct type")}
+		}
+		return valueSliceGetOps(value, fieldPath, etcdKey, tagOpts, plan)
+	}
+
 	if value.Len() < 1 {
 		return etcdOps, callbacks, nil
 	}
+	if isStructSlice(value.Type()) {
+		return createStructSliceGetOps(value, value.Index(0), fieldPath, etcdKey, pathvar, plan)
+	}
 	field := value.Index(0)
 
-	etcdKey = etcdKey + "/"
-
 	if field.Kind() == reflect.Ptr && field.Type().Implements(etcdValueType) {
 		if field.Interface().(EtcdValue).IsGet() {
-			etcdOps = append(etcdOps, clientv3.OpGet(etcdKey, clientv3.WithPrefix()))
-			callbacks = append(callbacks, func(resp *etcdserverpb.ResponseOp) error {
-				// Clear the slice of the `Get` pointer
-				value.Set(value.Slice(0, 0))
-				for j := 0; j < len(resp.GetResponseRange().Kvs); j++ {
-					// Create a new value to append into the slice
-					etcdVal := string(resp.GetResponseRange().Kvs[j].Value)
-
-					val := reflect.New(value.Type().Elem().Elem())
-					iface, ok := val.Interface().(EtcdValue)
-					if !ok {
-						return fmt.Errorf("Interface does not implement EtcdValue")
-					}
-
-					err := iface.FromString(etcdVal)
-					if err != nil {
-						return err
-					}
-
-					value.Set(reflect.Append(value, val))
-				}
-
-				return nil
-			})
+			return valueSliceGetOps(value, fieldPath, etcdKey, tagOpts, plan)
 		}
 	} else {
-		return nil, nil, fmt.Errorf("Slice must be of *EtcdValue type")
+		return nil, nil, &Error{Kind: ErrInvalidModel, Field: fieldPath, Key: etcdKey + "/", Err: fmt.Errorf("Slice must be of *EtcdValue or struct type")}
 	}
 
 	return etcdOps, callbacks, nil
 }
 
+// valueSliceGetOps builds the prefix get for a slice of EtcdValues and the
+// callback decoding every value under the prefix into the slice
+func valueSliceGetOps(value reflect.Value, fieldPath string, etcdKey string, tagOpts tagOptions, plan *getPlan) ([]clientv3.Op, []func(*etcdserverpb.ResponseOp) error, error) {
+	etcdKey = etcdKey + "/"
+
+	etcdOps := []clientv3.Op{clientv3.OpGet(etcdKey, clientv3.WithPrefix())}
+	callbacks := []func(*etcdserverpb.ResponseOp) error{func(resp *etcdserverpb.ResponseOp) error {
+		// Clear the slice of the `Get` pointer
+		value.Set(value.Slice(0, 0))
+		plan.clearMeta(fieldPath + "[")
+		for j := 0; j < len(resp.GetResponseRange().Kvs); j++ {
+			// Create a new value to append into the slice
+			kv := resp.GetResponseRange().Kvs[j]
+			elemName := fmt.Sprintf("%s[%d]", fieldPath, j)
+
+			val := reflect.New(value.Type().Elem().Elem())
+			iface, ok := val.Interface().(EtcdValue)
+			if !ok {
+				return &Error{Kind: ErrInvalidModel, Field: elemName, Key: string(kv.Key), Err: fmt.Errorf("Interface does not implement EtcdValue")}
+			}
+
+			data, err := plan.decode(tagOpts, kv)
+			if err == nil {
+				err = iface.FromString(data)
+			}
+			if err != nil {
+				return &Error{Kind: ErrDecode, Field: elemName, Key: string(kv.Key), Err: err}
+			}
+			plan.recordMeta(elemName, kv)
+
+			value.Set(reflect.Append(value, val))
+		}
+
+		return nil
+	}}
+
+	return etcdOps, callbacks, nil
+}
+
+// Set writes and deletes the fields of s
 func (c *store) Set(s interface{}, pathvar map[string]string) error {
+	return c.SetCtx(context.Background(), s, pathvar)
+}
+
+// SetCtx is Set bounded by ctx
+func (c *store) SetCtx(ctx context.Context, s interface{}, pathvar map[string]string, opts ...OpOption) error {
+	_, err := c.SetWithLeases(ctx, s, pathvar, opts...)
+	return err
+}
+
+// SetWithLeases is SetCtx that also returns the leases granted for ttl tagged
+// fields, so they can be kept alive or revoked
+func (c *store) SetWithLeases(ctx context.Context, s interface{}, pathvar map[string]string, opts ...OpOption) ([]*Lease, error) {
 	// Get the reflected value
 	value := reflect.ValueOf(s)
 	// Verify that the value is a pointer
 	if value.Kind() != reflect.Ptr {
-		err := fmt.Errorf("Provided interface is not a pointer")
+		err := &Error{Kind: ErrInvalidModel, Err: fmt.Errorf("Provided interface is not a pointer")}
 		c.logger.Error("Error validating interface", zap.Error(err))
-		return err
+		return nil, err
 	}
 	// Verify the pointer points to a struct
 	value = value.Elem()
 	if value.Kind() != reflect.Struct {
-		err := fmt.Errorf("Provided interface is does not reference a struct")
+		err := &Error{Kind: ErrInvalidModel, Err: fmt.Errorf("Provided interface is does not reference a struct")}
 		c.logger.Error("Error validating interface", zap.Error(err))
-		return err
+		return nil, err
 	}
 
 	pathvar["@"] = ""
 
-	etcdOps, err := createStructSetOps(value, pathvar, false)
+	o := newOpOptions(opts...)
+	mask := newFieldMask(o.fields)
+	if err := mask.check(value.Type()); err != nil {
+		c.logger.Error("Error validating fields", zap.Error(err))
+		return nil, err
+	}
+
+	ctx, cancel := c.requestContext(ctx)
+	defer cancel()
+
+	return c.setWithRetries(ctx, o, func(plan *setPlan) ([]clientv3.Op, error) {
+		plan.mask = mask
+		return createStructSetOps(value, value.Type().Name(), pathvar, false, plan)
+	})
+}
+
+// setWithRetries commits the ops built by build, building them again when
+// keys read while building them changed before they committed
+func (c *store) setWithRetries(ctx context.Context, o *opOptions, build func(*setPlan) ([]clientv3.Op, error)) ([]*Lease, error) {
+	for attempt := 1; ; attempt++ {
+		leases, retry, err := c.set(ctx, o, build)
+		if !retry || attempt >= maxSetAttempts {
+			return leases, err
+		}
+		c.logger.Info("Retrying set after keys it read changed", zap.Error(err))
+	}
+}
+
+// maxSetAttempts bounds how often a Set is rebuilt when keys read while
+// building its ops change before it commits
+const maxSetAttempts = 5
+
+// set builds and commits the txn for a single attempt of a Set. retry is
+// true when it failed only because keys read while building it changed
+func (c *store) set(ctx context.Context, o *opOptions, build func(*setPlan) ([]clientv3.Op, error)) ([]*Lease, bool, error) {
+	plan := newSetPlan(ctx, c)
+	etcdOps, err := build(plan)
 	if err != nil {
 		c.logger.Error("Error generating ops", zap.Error(err))
-		return err
+		plan.leases.revoke()
+		return nil, false, err
 	}
 
-	txn := c.client.Txn(context.Background()).If().Then(etcdOps...)
-	resp, err := txn.Commit()
+	guards := o.guards(etcdOps, plan)
+	cmps, elseOps := guardOps(guards)
+
+	var resp *clientv3.TxnResponse
+	err = c.authenticated(ctx, func(ctx context.Context) error {
+		resp, err = c.client.Txn(ctx).If(cmps...).Then(etcdOps...).Else(elseOps...).Commit()
+		return err
+	})
 	if err != nil {
 		c.logger.Error("Error performing ops", zap.Error(err))
-		return err
+		plan.leases.revoke()
+		return nil, false, txnError(err)
+	}
+
+	if !resp.Succeeded {
+		plan.leases.revoke()
+		err = conflictError(guards, resp)
+		c.logger.Info("Set guard failed", zap.Error(err))
+		return nil, onlyReadsChanged(guards, resp), err
 	}
 
 	if len(resp.Responses) != len(etcdOps) {
-		err = fmt.Errorf("Unexpected number of responses")
+		err = &Error{Kind: ErrTxnFailed, Err: fmt.Errorf("Unexpected number of responses")}
 		c.logger.Error("Invalid etcd response", zap.Error(err))
+		return nil, false, err
+	}
+
+	return plan.leases.list(), false, nil
+}
+
+// SetIfUnchanged is SetCtx that only applies if none of the keys it writes
+// were modified since the Get that recorded revs
+func (c *store) SetIfUnchanged(ctx context.Context, s interface{}, pathvar map[string]string, revs *Revisions) error {
+	return c.SetCtx(ctx, s, pathvar, IfUnchanged(revs))
+}
+
+// setPlan holds the state shared by the op builders of a single Set call
+type setPlan struct {
+	ctx    context.Context
+	store  *store
+	leases *leaseSet
+	// fields maps the key, or start of the range, of every op to the Go
+	// field path it was built for
+	fields map[string]string
+	// reads lists the prefixes read while building the ops, all at readRev
+	reads   []prefixRead
+	readRev int64
+	// mask selects the fields written when set
+	mask *fieldMask
+	// hashing is set on the plans building the content of hashed element
+	// IDs, which cannot include encrypted values
+	hashing bool
+}
+
+// prefixRead is a prefix read by a Set and the field it was read for
+type prefixRead struct {
+	field  string
+	prefix string
+}
+
+func newSetPlan(ctx context.Context, c *store) *setPlan {
+	return &setPlan{
+		ctx:    ctx,
+		store:  c,
+		leases: newLeaseSet(ctx, c),
+		fields: map[string]string{},
+	}
+}
+
+// readPrefix returns the key values stored under prefix. Every read of a plan is
+// served at the same revision, and the txn is guarded against changes under
+// the prefix after it
+func (p *setPlan) readPrefix(field string, prefix string, opts ...clientv3.OpOption) ([]*mvccpb.KeyValue, error) {
+	getOpts := append([]clientv3.OpOption{clientv3.WithPrefix()}, opts...)
+	if p.readRev > 0 {
+		getOpts = append(getOpts, clientv3.WithRev(p.readRev))
+	}
+
+	var resp *clientv3.GetResponse
+	err := p.store.authenticated(p.ctx, func(ctx context.Context) error {
+		var err error
+		resp, err = p.store.client.Get(ctx, prefix, getOpts...)
 		return err
+	})
+	if err != nil {
+		return nil, txnError(err)
 	}
 
-	return nil
+	if p.readRev == 0 {
+		p.readRev = resp.Header.Revision
+	}
+	p.reads = append(p.reads, prefixRead{field: field, prefix: prefix})
+	return resp.Kvs, nil
+}
+
+// fieldMask returns the mask of the Set, nil when every field is written
+func (p *setPlan) fieldMask() *fieldMask {
+	if p == nil {
+		return nil
+	}
+	return p.mask
+}
+
+// encode converts the data encoded by a field's type to the value written
+// at key for a field with tagOpts
+func (p *setPlan) encode(tagOpts tagOptions, key string, data string) (string, error) {
+	data, err := tagOpts.encode(data)
+	if err != nil {
+		return "", err
+	}
+	s := p.store
+	if s == nil {
+		s = &store{}
+	}
+
+	// Hashed element IDs do not depend on the compression
+	if !p.hashing {
+		compression := tagOpts.compress
+		if compression == "" {
+			compression = s.compression
+		}
+		if data, err = compressValue(data, compression); err != nil {
+			return "", err
+		}
+	}
+	if tagOpts.encrypt {
+		if p.hashing {
+			return "", fmt.Errorf("encrypted fields cannot be part of hashed element IDs")
+		}
+		if data, err = encryptValue(p.ctx, s.keys, data); err != nil {
+			return "", err
+		}
+	}
+	// Hashed element IDs do not change when the signing key rotates
+	if s.signingKeys != nil && !p.hashing {
+		return signValue(p.ctx, s.signingKeys, key, data)
+	}
+	return data, nil
 }
 
-func createStructSetOps(value reflect.Value, pathvar map[string]string, inslice bool) ([]clientv3.Op, error) {
+// resign returns the value read from key from signed for key to instead.
+// Values are returned as they are when the store does not sign them
+func (p *setPlan) resign(from string, to string, value []byte) (string, error) {
+	if p.store == nil || p.store.signingKeys == nil {
+		return string(value), nil
+	}
+	data, err := verifyValue(p.ctx, p.store.signingKeys, from, string(value))
+	if err != nil {
+		return "", err
+	}
+	return signValue(p.ctx, p.store.signingKeys, to, data)
+}
+
+// record notes the field op was built for and returns op
+func (p *setPlan) record(fieldName string, op clientv3.Op) clientv3.Op {
+	p.fields[string(op.KeyBytes())] = fieldName
+	return op
+}
+
+// createStructSetOps builds the put and delete ops for the tagged fields of
+// value. fieldPath is the Go path of value used to identify fields in errors
+func createStructSetOps(value reflect.Value, fieldPath string, pathvar map[string]string, inslice bool, plan *setPlan) ([]clientv3.Op, error) {
 	etcdOps := []clientv3.Op{}
 
 	for i := 0; i < value.NumField(); i++ {
 		field := value.Field(i)
+		fieldName := fieldPath + "." + value.Type().Field(i).Name
 		// If the struct field has not path tag it will be ignored
 		tag, ok := value.Type().Field(i).Tag.Lookup(tagKey)
 		if !ok {
 			continue
 		}
 
-		etcdKey, err := pathReplace(tag, pathvar, inslice)
+		path, tagOpts, err := parseTag(tag)
 		if err != nil {
-			return nil, err
+			return nil, withField(err, fieldName)
+		}
+		etcdKey, err := pathReplace(path, pathvar, inslice)
+		if err != nil {
+			return nil, withField(err, fieldName)
+		}
+		if tagOpts.prune && field.Kind() != reflect.Map {
+			return nil, &Error{Kind: ErrInvalidModel, Field: fieldName, Err: fmt.Errorf("prune can only be set on map fields")}
+		}
+		if (tagOpts.id != "" || tagOpts.ordered || tagOpts.replace) && field.Kind() != reflect.Slice {
+			return nil, &Error{Kind: ErrInvalidModel, Field: fieldName, Err: fmt.Errorf("id, ordered and replace can only be set on slice fields")}
+		}
+		if tagOpts.binary && !isUUIDField(field.Type()) {
+			return nil, &Error{Kind: ErrInvalidModel, Field: fieldName, Err: fmt.Errorf("binary can only be set on UUID fields")}
+		}
+		if tagOpts.format != "" && !isTimeField(field.Type()) {
+			return nil, &Error{Kind: ErrInvalidModel, Field: fieldName, Err: fmt.Errorf("format can only be set on time fields")}
+		}
+		if tagOpts.encoding != "" && !isBytesField(field.Type()) {
+			return nil, &Error{Kind: ErrInvalidModel, Field: fieldName, Err: fmt.Errorf("encoding can only be set on byte fields")}
+		}
+		if tagOpts.encrypt && tagOpts.id == idHash {
+			return nil, &Error{Kind: ErrInvalidModel, Field: fieldName, Err: fmt.Errorf("encrypted fields cannot be part of hashed element IDs")}
+		}
+		if mask := plan.fieldMask(); mask != nil {
+			selected, below := mask.match(fieldName)
+			if !selected && !below {
+				continue
+			}
+			// Entries are only removed when the whole field is written
+			if !selected {
+				tagOpts.prune, tagOpts.replace = false, false
+			}
 		}
 
 		if field.Kind() == reflect.Ptr && field.Type().Implements(etcdValueType) {
 			iface, ok := field.Interface().(EtcdValue)
 			if !ok {
-				err = fmt.Errorf("failed to cast interface")
+				err = &Error{Kind: ErrInvalidModel, Field: fieldName, Key: etcdKey, Err: fmt.Errorf("failed to cast interface")}
 				return nil, err
 			}
 			if iface.IsDelete() {
-				etcdOps = append(etcdOps, clientv3.OpDelete(etcdKey))
+				etcdOps = append(etcdOps, plan.record(fieldName, clientv3.OpDelete(etcdKey)))
 			} else if iface.IsSet() {
-				etcdOps = append(etcdOps, clientv3.OpPut(etcdKey, iface.ToString()))
+				op, err := putValue(plan, fieldName, etcdKey, iface, tagOpts)
+				if err != nil {
+					return nil, err
+				}
+				etcdOps = append(etcdOps, op)
+			}
+		} else if codec := plainCodec(field.Type()); codec != nil {
+			data, ok, err := encodeValue(codec, field)
+			if err != nil {
+				return nil, &Error{Kind: ErrEncode, Field: fieldName, Key: etcdKey, Err: err}
+			}
+			if !ok {
+				continue
+			}
+			op, err := putData(plan, fieldName, etcdKey, data, tagOpts)
+			if err != nil {
+				return nil, err
 			}
+			etcdOps = append(etcdOps, op)
 		} else if field.Kind() == reflect.Struct {
+			if tagOpts.ttl > 0 {
+				return nil, &Error{Kind: ErrInvalidModel, Field: fieldName, Err: fmt.Errorf("ttl can only be set on value and slice fields")}
+			}
+			if tagOpts.encrypt {
+				return nil, &Error{Kind: ErrInvalidModel, Field: fieldName, Err: fmt.Errorf("encrypt can only be set on value fields")}
+			}
+			if tagOpts.compress != "" {
+				return nil, &Error{Kind: ErrInvalidModel, Field: fieldName, Err: fmt.Errorf("compress can only be set on value fields")}
+			}
+			parent := pathvar["@"]
 			pathvar["@"] = etcdKey
-			newOps, err := createStructSetOps(field, pathvar, inslice)
+			newOps, err := createStructSetOps(field, fieldName, pathvar, inslice, plan)
+			pathvar["@"] = parent
 			if err != nil {
 				return nil, err
 			}
 			etcdOps = append(etcdOps, newOps...)
 		} else if field.Kind() == reflect.Slice {
-			newOps, err := createSliceSetOps(field, etcdKey, true)
+			var newOps []clientv3.Op
+			if isStructSlice(field.Type()) {
+				if tagOpts.ttl > 0 {
+					return nil, &Error{Kind: ErrInvalidModel, Field: fieldName, Err: fmt.Errorf("ttl can only be set on value and slice fields")}
+				}
+				if tagOpts.encrypt {
+					return nil, &Error{Kind: ErrInvalidModel, Field: fieldName, Err: fmt.Errorf("encrypt can only be set on value fields")}
+				}
+				if tagOpts.compress != "" {
+					return nil, &Error{Kind: ErrInvalidModel, Field: fieldName, Err: fmt.Errorf("compress can only be set on value fields")}
+				}
+				newOps, err = createStructSliceSetOps(field, fieldName, etcdKey, pathvar, tagOpts, plan)
+			} else {
+				newOps, err = createSliceSetOps(field, fieldName, etcdKey, true, tagOpts, plan)
+			}
+			if err == nil && tagOpts.replace && !field.IsNil() {
+				newOps, err = replaceSliceOps(newOps, fieldName, etcdKey, plan)
+			}
+			if err != nil {
+				return nil, err
+			}
+			etcdOps = append(etcdOps, newOps...)
+		} else if field.Kind() == reflect.Map {
+			newOps, err := createMapSetOps(field, fieldName, etcdKey, pathvar, tagOpts, plan)
 			if err != nil {
 				return nil, err
 			}
@@ -301,33 +836,41 @@ func createStructSetOps(value reflect.Value, pathvar map[string]string, inslice
 	return etcdOps, nil
 }
 
-func createSliceSetOps(value reflect.Value, etcdKey string, inslice bool) ([]clientv3.Op, error) {
+func createSliceSetOps(value reflect.Value, fieldPath string, etcdKey string, inslice bool, tagOpts tagOptions, plan *setPlan) ([]clientv3.Op, error) {
 	etcdOps := []clientv3.Op{}
 
 	if value.Len() == 1 {
 		field := value.Index(0)
 		if field.Kind() == reflect.Ptr && field.Type().Implements(etcdValueType) && field.Interface().(EtcdValue).IsDelete() {
 			// Delete all items in this slice
-			etcdOps = append(etcdOps, clientv3.OpDelete(etcdKey+"/", clientv3.WithPrefix()))
+			etcdOps = append(etcdOps, plan.record(fieldPath, clientv3.OpDelete(etcdKey+"/", clientv3.WithPrefix())))
 			return etcdOps, nil
 		}
 	}
 
+	ids := newIDGenerator(fieldPath, etcdKey, tagOpts, plan)
 	for i := 0; i < value.Len(); i++ {
 		field := value.Index(i)
+		elemName := fmt.Sprintf("%s[%d]", fieldPath, i)
 
 		if field.Kind() == reflect.Ptr && field.Type().Implements(etcdValueType) && field.Interface().(EtcdValue).IsSet() {
-			etcdKey = etcdKey + "/" + GenerateUniqueID()
 			iface, ok := field.Interface().(EtcdValue)
 			if !ok {
-				err := fmt.Errorf("failed to cast interface")
+				err := &Error{Kind: ErrInvalidModel, Field: elemName, Err: fmt.Errorf("failed to cast interface")}
 				return nil, err
 			}
+			id, err := ids.next(func() (string, error) {
+				return encodeEtcdValue(iface)
+			})
+			if err != nil {
+				return nil, withField(err, elemName)
+			}
 
-			etcdOps = append(etcdOps, clientv3.OpPut(etcdKey, iface.ToString()))
-		} else if field.Kind() == reflect.Struct {
-			err := fmt.Errorf("Cannot set a slice of structs. Structs must be set individually")
-			return nil, err
+			op, err := putValue(plan, elemName, etcdKey+"/"+id, iface, tagOpts)
+			if err != nil {
+				return nil, err
+			}
+			etcdOps = append(etcdOps, op)
 		}
 	}
 
@@ -335,9 +878,65 @@ func createSliceSetOps(value reflect.Value, etcdKey string, inslice bool) ([]cli
 }
 
 func (c *store) Close() error {
+	if !c.ownsClient {
+		return nil
+	}
 	return c.client.Close()
 }
 
+// leasePutOptions returns the put options attaching a field's keys to the
+// lease for its ttl, if it has one
+func leasePutOptions(opts tagOptions, leases *leaseSet) ([]clientv3.OpOption, error) {
+	if opts.ttl <= 0 {
+		return nil, nil
+	}
+	id, err := leases.grant(opts.ttl)
+	if err != nil {
+		return nil, err
+	}
+	return []clientv3.OpOption{clientv3.WithLease(id)}, nil
+}
+
+// putValue builds the put of an EtcdValue written for field
+func putValue(plan *setPlan, fieldName string, key string, iface EtcdValue, tagOpts tagOptions) (clientv3.Op, error) {
+	data, err := encodeEtcdValue(iface)
+	if err != nil {
+		return clientv3.Op{}, &Error{Kind: ErrEncode, Field: fieldName, Key: key, Err: err}
+	}
+	return putData(plan, fieldName, key, data, tagOpts)
+}
+
+// putData builds the put of the encoded value of field, attaching it to the
+// lease for the field's ttl
+func putData(plan *setPlan, fieldName string, key string, data string, tagOpts tagOptions) (clientv3.Op, error) {
+	data, err := plan.encode(tagOpts, key, data)
+	if err != nil {
+		return clientv3.Op{}, &Error{Kind: ErrEncode, Field: fieldName, Key: key, Err: err}
+	}
+	putOpts, err := leasePutOptions(tagOpts, plan.leases)
+	if err != nil {
+		return clientv3.Op{}, withField(err, fieldName)
+	}
+	return plan.record(fieldName, clientv3.OpPut(key, data, putOpts...)), nil
+}
+
+// txnError wraps an error from committing a transaction. Auth failures are
+// returned as they are so they stay distinguishable
+func txnError(err error) error {
+	if _, ok := err.(*AuthError); ok {
+		return err
+	}
+	return &Error{Kind: ErrTxnFailed, Err: err}
+}
+
+// requestContext applies the store's default request timeout to ctx
+func (c *store) requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.timeout)
+}
+
 // pathReplace replaces the stub values for the pathvars and returns
 // the fully qualified path
 func pathReplace(path string, pathvars map[string]string, inslice bool) (string, error) {
@@ -346,11 +945,11 @@ func pathReplace(path string, pathvars map[string]string, inslice bool) (string,
 		if strings.HasPrefix(p, ":") {
 			variable := strings.TrimPrefix(p, ":")
 			if variable == "@" && inslice {
-				return "", fmt.Errorf("cannot use @ pathvar inside slice")
+				return "", &Error{Kind: ErrInvalidModel, Err: fmt.Errorf("cannot use @ pathvar inside slice")}
 			}
 			val, ok := pathvars[strings.TrimPrefix(p, ":")]
 			if !ok {
-				return "", fmt.Errorf("pathvar %s not populated", p)
+				return "", &Error{Kind: ErrPathVarMissing, Err: fmt.Errorf("pathvar %s not populated", p)}
 			}
 			path = strings.Replace(path, p, val, -1)
 		}
@@ -1,6 +1,9 @@
 package etcdclient
 
 import (
+	"context"
+	"errors"
+	"net"
 	"testing"
 	"time"
 
@@ -22,10 +25,10 @@ type TestModel2Child struct {
 type TestModel2Parent struct {
 	//CurrentTime *EtcdTime   `path:"/path/:var/to/key"`
 	//SecondTime  *EtcdTime   `path:"/path/:var/to/second_key"`
-	Name  *EtcdString `path:"/path/:var/to/name"`
-	ID    *EtcdUuid   `path:"/path/:var/to/id"`
-	Count *EtcdUint   `path:"/path/:var/to/count_key"`
-	Child TestModel2Child  `path:"/path/:var/to/child"`
+	Name  *EtcdString     `path:"/path/:var/to/name"`
+	ID    *EtcdUuid       `path:"/path/:var/to/id"`
+	Count *EtcdUint       `path:"/path/:var/to/count_key"`
+	Child TestModel2Child `path:"/path/:var/to/child"`
 }
 
 type TestModel3 struct {
@@ -67,7 +70,7 @@ func TestEtcdClient(t *testing.T) {
 				//CurrentTime: SetTime(testTime),
 				//SecondTime:  SetTime(testTime),
 				Name:  SetString("test"),
-				ID:    SetUuid("uuid-test"),
+				ID:    SetUuid("00000000-0000-4000-8000-000000000001"),
 				Count: SetUint(42),
 				Child: TestModel2Child{
 					BoolKey: SetBool(true),
@@ -92,7 +95,7 @@ func TestEtcdClient(t *testing.T) {
 				//CurrentTime: SetTime(testTime),
 				//SecondTime:  SetTime(testTime),
 				Name:  SetString("test"),
-				ID:    SetUuid("uuid-test"),
+				ID:    SetUuid("00000000-0000-4000-8000-000000000001"),
 				Count: SetUint(42),
 				Child: TestModel2Child{
 					BoolKey: SetBool(true),
@@ -106,7 +109,7 @@ func TestEtcdClient(t *testing.T) {
 				//CurrentTime: SetTime(testTime),
 				//SecondTime:  SetTime(testTime),
 				Name:  SetString("test2"),
-				ID:    SetUuid("uuid-test2"),
+				ID:    SetUuid("00000000-0000-4000-8000-000000000002"),
 				Count: nil,
 				Child: TestModel2Child{
 					BoolKey: nil,
@@ -131,7 +134,7 @@ func TestEtcdClient(t *testing.T) {
 				//CurrentTime: SetTime(testTime),
 				//SecondTime:  SetTime(testTime),
 				Name:  SetString("test2"),
-				ID:    SetUuid("uuid-test2"),
+				ID:    SetUuid("00000000-0000-4000-8000-000000000002"),
 				Count: SetUint(42),
 				Child: TestModel2Child{
 					BoolKey: SetBool(true),
@@ -169,7 +172,7 @@ func TestEtcdClient(t *testing.T) {
 			expectedData: TestModel2Parent{
 				//CurrentTime: SetTime(testTime),
 				//SecondTime:  SetTime(testTime),
-				ID: SetUuid("uuid-test2"),
+				ID: SetUuid("00000000-0000-4000-8000-000000000002"),
 				Child: TestModel2Child{
 					BoolKey: SetBool(true),
 					IntKey:  SetInt(44),
@@ -182,7 +185,7 @@ func TestEtcdClient(t *testing.T) {
 				//CurrentTime: SetTime(testTime),
 				//SecondTime:  SetTime(testTime),
 				Name:  SetString("test"),
-				ID:    SetUuid("uuid-test"),
+				ID:    SetUuid("00000000-0000-4000-8000-000000000001"),
 				Count: SetUint(42),
 				Child: TestModel2Child{
 					BoolKey: SetBool(true),
@@ -215,13 +218,7 @@ func TestEtcdClient(t *testing.T) {
 
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
-			conf := &config.GlobalConfig{
-				Etcd: &config.EtcdConfig{
-					Endpoints: []string{"http://localhost:2379"},
-				},
-			}
-
-			store, err := NewEtcdStore(conf, config.GetLogger())
+			store, err := New(WithEndpoints("http://localhost:2379"))
 			require.NoError(t, err)
 			defer store.Close()
 			err = store.Set(&tc.dataToSet, tc.pathvar)
@@ -266,13 +263,7 @@ func TestEtcdClientTimeTypes(t *testing.T) {
 
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
-			conf := &config.GlobalConfig{
-				Etcd: &config.EtcdConfig{
-					Endpoints: []string{"http://localhost:2379"},
-				},
-			}
-
-			store, err := NewEtcdStore(conf, config.GetLogger())
+			store, err := New(WithEndpoints("http://localhost:2379"))
 			require.NoError(t, err)
 			defer store.Close()
 			err = store.Set(&tc.dataToSet, tc.pathvar)
@@ -350,13 +341,7 @@ func TestEtcdClientSlice(t *testing.T) {
 
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
-			conf := &config.GlobalConfig{
-				Etcd: &config.EtcdConfig{
-					Endpoints: []string{"http://localhost:2379"},
-				},
-			}
-
-			store, err := NewEtcdStore(conf, config.GetLogger())
+			store, err := New(WithEndpoints("http://localhost:2379"))
 			require.NoError(t, err)
 			defer store.Close()
 			err = store.Set(&tc.dataToSet, tc.pathvar)
@@ -372,3 +357,311 @@ func TestEtcdClientSlice(t *testing.T) {
 		})
 	}
 }
+
+type TestHeartbeat struct {
+	Name      *EtcdString `path:"/path/:var/to/name"`
+	Heartbeat *EtcdTime   `path:"/path/:var/to/heartbeat,ttl=30s"`
+}
+
+func TestEtcdClientLease(t *testing.T) {
+	pathvar := map[string]string{
+		"var": "lease",
+	}
+
+	store, err := New(WithEndpoints("http://localhost:2379"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	leases, err := store.SetWithLeases(context.Background(), &TestHeartbeat{
+		Name:      SetString("test"),
+		Heartbeat: SetTime(testTime),
+	}, pathvar)
+	require.NoError(t, err)
+	require.Len(t, leases, 1)
+	assert.Equal(t, 30*time.Second, leases[0].TTL)
+	require.NoError(t, leases[0].KeepAliveOnce(context.Background()))
+
+	dataToGet := TestHeartbeat{
+		Name:      GetString(),
+		Heartbeat: GetTime(),
+	}
+	require.NoError(t, store.Get(&dataToGet, pathvar))
+	require.NotNil(t, dataToGet.Heartbeat)
+	assert.True(t, time.Time(*dataToGet.Heartbeat).Equal(testTime))
+
+	// Revoking the lease removes only the keys attached to it
+	require.NoError(t, leases[0].Revoke(context.Background()))
+	dataToGet = TestHeartbeat{
+		Name:      GetString(),
+		Heartbeat: GetTime(),
+	}
+	require.NoError(t, store.Get(&dataToGet, pathvar))
+	assert.Equal(t, TestHeartbeat{Name: SetString("test")}, dataToGet)
+}
+
+func TestEtcdClientSetIfUnchanged(t *testing.T) {
+	pathvar := map[string]string{
+		"var": "cas",
+	}
+
+	store, err := New(WithEndpoints("http://localhost:2379"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	require.NoError(t, store.Set(&TestModel2Parent{
+		Name:  SetString("first"),
+		Count: SetUint(1),
+	}, pathvar))
+
+	revs := &Revisions{}
+	dataToGet := TestModel2Parent{
+		Name:  GetString(),
+		Count: GetUint(),
+	}
+	require.NoError(t, store.GetCtx(context.Background(), &dataToGet, pathvar, WithRevisions(revs)))
+
+	// Another writer changes the name underneath us
+	require.NoError(t, store.Set(&TestModel2Parent{Name: SetString("second")}, pathvar))
+
+	err = store.SetIfUnchanged(context.Background(), &TestModel2Parent{
+		Name:  SetString("third"),
+		Count: SetUint(2),
+	}, pathvar, revs)
+	require.True(t, errors.Is(err, ErrConflict))
+	var conflict *ConflictError
+	require.True(t, errors.As(err, &conflict))
+	assert.Equal(t, []string{"TestModel2Parent.Name"}, conflict.Fields)
+
+	// Writing only the unchanged field succeeds
+	err = store.SetIfUnchanged(context.Background(), &TestModel2Parent{
+		Count: SetUint(2),
+	}, pathvar, revs)
+	require.NoError(t, err)
+}
+
+func TestEtcdClientSetModes(t *testing.T) {
+	pathvar := map[string]string{
+		"var": GenerateUniqueID(),
+	}
+
+	store, err := New(WithEndpoints("http://localhost:2379"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	// Updating a record that was never registered fails
+	err = store.SetCtx(context.Background(), &TestModel2Parent{Name: SetString("test")}, pathvar, UpdateOnly())
+	require.True(t, errors.Is(err, ErrConflict))
+
+	require.NoError(t, store.SetCtx(context.Background(), &TestModel2Parent{Name: SetString("test")}, pathvar, CreateOnly()))
+
+	// Registering it a second time fails
+	err = store.SetCtx(context.Background(), &TestModel2Parent{Name: SetString("test")}, pathvar, CreateOnly())
+	require.True(t, errors.Is(err, ErrConflict))
+
+	require.NoError(t, store.SetCtx(context.Background(), &TestModel2Parent{Name: SetString("patched")}, pathvar, UpdateOnly()))
+}
+
+func TestEtcdClientStructSlice(t *testing.T) {
+	pathvar := map[string]string{
+		"var": GenerateUniqueID(),
+	}
+
+	store, err := New(WithEndpoints("http://localhost:2379"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	require.NoError(t, store.Set(&TestRecords{
+		Records: []TestRecord{
+			{Name: SetString("first"), Count: SetInt(1)},
+		},
+	}, pathvar))
+
+	dataToGet := TestRecords{
+		Records: []TestRecord{{Name: GetString(), Count: GetInt()}},
+	}
+	require.NoError(t, store.Get(&dataToGet, pathvar))
+	assert.Equal(t, []TestRecord{{Name: SetString("first"), Count: SetInt(1)}}, dataToGet.Records)
+}
+
+func TestEtcdClientMap(t *testing.T) {
+	pathvar := map[string]string{
+		"var": GenerateUniqueID(),
+	}
+
+	store, err := New(WithEndpoints("http://localhost:2379"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	require.NoError(t, store.Set(&TestMaps{
+		Labels: map[string]*EtcdString{"env": SetString("prod"), "team": SetString("core")},
+		Pruned: map[string]*EtcdString{"a": SetString("one"), "b": SetString("two")},
+	}, pathvar))
+
+	// Entries missing from a pruned map are deleted, other maps keep them
+	require.NoError(t, store.Set(&TestMaps{
+		Labels: map[string]*EtcdString{"env": SetString("dev")},
+		Pruned: map[string]*EtcdString{"b": SetString("three")},
+	}, pathvar))
+
+	dataToGet := TestMaps{
+		Labels: map[string]*EtcdString{"*": GetString()},
+		Pruned: map[string]*EtcdString{"*": GetString()},
+	}
+	require.NoError(t, store.Get(&dataToGet, pathvar))
+	assert.Equal(t, map[string]*EtcdString{"env": SetString("dev"), "team": SetString("core")}, dataToGet.Labels)
+	assert.Equal(t, map[string]*EtcdString{"b": SetString("three")}, dataToGet.Pruned)
+}
+
+func TestEtcdClientElements(t *testing.T) {
+	pathvar := map[string]string{
+		"var": GenerateUniqueID(),
+	}
+
+	store, err := New(WithEndpoints("http://localhost:2379"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	model := TestElements{
+		Elements: []*TestElement{{Name: SetString("first")}, {Name: SetString("second")}},
+	}
+	require.NoError(t, store.Set(&model, pathvar))
+	// Saving again keeps the IDs instead of duplicating the elements
+	require.NoError(t, store.Set(&model, pathvar))
+
+	first, second := model.Elements[0].ElementID(), model.Elements[1].ElementID()
+	require.NoError(t, store.SetElement(context.Background(), &TestElements{}, pathvar, "Elements", first, &TestElement{Name: SetString("updated")}))
+	require.NoError(t, store.DeleteElement(context.Background(), &TestElements{}, pathvar, "Elements", second))
+
+	dataToGet := TestElements{
+		Elements: []*TestElement{{Name: GetString()}},
+	}
+	require.NoError(t, store.Get(&dataToGet, pathvar))
+	require.Len(t, dataToGet.Elements, 1)
+	assert.Equal(t, first, dataToGet.Elements[0].ElementID())
+	assert.Equal(t, SetString("updated"), dataToGet.Elements[0].Name)
+}
+
+func TestEtcdClientOrderedList(t *testing.T) {
+	pathvar := map[string]string{
+		"var": GenerateUniqueID(),
+	}
+
+	store, err := New(WithEndpoints("http://localhost:2379"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	// Set appends to the end of an ordered list
+	require.NoError(t, store.Set(&TestList{Values: []*EtcdString{SetString("b"), SetString("d")}}, pathvar))
+	require.NoError(t, store.Set(&TestList{Values: []*EtcdString{SetString("e")}}, pathvar))
+
+	ctx := context.Background()
+	require.NoError(t, store.InsertElement(ctx, &TestList{}, pathvar, "Values", 0, SetString("a")))
+	require.NoError(t, store.InsertElement(ctx, &TestList{}, pathvar, "Values", 2, SetString("c")))
+	require.NoError(t, store.MoveElement(ctx, &TestList{}, pathvar, "Values", 4, 0))
+	require.NoError(t, store.TruncateElements(ctx, &TestList{}, pathvar, "Values", 4))
+
+	dataToGet := TestList{Values: []*EtcdString{GetString()}}
+	require.NoError(t, store.Get(&dataToGet, pathvar))
+	assert.Equal(t, []*EtcdString{SetString("e"), SetString("a"), SetString("b"), SetString("c")}, dataToGet.Values)
+
+	err = store.MoveElement(ctx, &TestList{}, pathvar, "Values", 0, 4)
+	assert.True(t, errors.Is(err, ErrOutOfRange))
+	err = store.InsertElement(ctx, &TestList{}, pathvar, "Records", 0, TestRecord{})
+	assert.True(t, errors.Is(err, ErrInvalidModel))
+}
+
+type TestReplaced struct {
+	Values []*EtcdString `path:"/path/:var/values,replace"`
+	Steps  []*EtcdString `path:"/path/:var/steps,ordered,replace"`
+}
+
+func TestEtcdClientReplaceSlice(t *testing.T) {
+	pathvar := map[string]string{
+		"var": GenerateUniqueID(),
+	}
+
+	store, err := New(WithEndpoints("http://localhost:2379"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	require.NoError(t, store.Set(&TestReplaced{
+		Values: []*EtcdString{SetString("a"), SetString("b")},
+		Steps:  []*EtcdString{SetString("one"), SetString("two"), SetString("three")},
+	}, pathvar))
+	require.NoError(t, store.Set(&TestReplaced{
+		Values: []*EtcdString{SetString("c")},
+		Steps:  []*EtcdString{SetString("four")},
+	}, pathvar))
+
+	dataToGet := TestReplaced{
+		Values: []*EtcdString{GetString()},
+		Steps:  []*EtcdString{GetString()},
+	}
+	require.NoError(t, store.Get(&dataToGet, pathvar))
+	assert.Equal(t, []*EtcdString{SetString("c")}, dataToGet.Values)
+	assert.Equal(t, []*EtcdString{SetString("four")}, dataToGet.Steps)
+
+	// An empty slice clears the field
+	require.NoError(t, store.Set(&TestReplaced{Values: []*EtcdString{}}, pathvar))
+	dataToGet = TestReplaced{Values: []*EtcdString{GetString()}}
+	require.NoError(t, store.Get(&dataToGet, pathvar))
+	assert.Empty(t, dataToGet.Values)
+}
+
+func TestEtcdClientPlainTypes(t *testing.T) {
+	pathvar := map[string]string{
+		"var": GenerateUniqueID(),
+	}
+
+	store, err := New(WithEndpoints("http://localhost:2379"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	ratio := 0.5
+	dataToSet := TestPlain{
+		Name:    "test",
+		Count:   42,
+		Ratio:   &ratio,
+		Created: testTime,
+		Data:    []byte("data"),
+		Addr:    net.ParseIP("10.0.0.1"),
+	}
+	require.NoError(t, store.Set(&dataToSet, pathvar))
+
+	dataToGet := TestPlain{}
+	require.NoError(t, store.Get(&dataToGet, pathvar))
+	assert.Equal(t, dataToSet, dataToGet)
+}
+
+func TestEtcdClientFieldMask(t *testing.T) {
+	pathvar := map[string]string{
+		"var": GenerateUniqueID(),
+	}
+
+	store, err := New(WithEndpoints("http://localhost:2379"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	dataToSet := TestMasked{
+		Name:    "test",
+		Child:   TestMaskedChild{Flag: true, Count: 3},
+		Records: []TestRecord{{Name: SetString("first"), Count: SetInt(1)}},
+	}
+	require.NoError(t, store.SetCtx(context.Background(), &dataToSet, pathvar))
+
+	dataToGet := TestMasked{}
+	require.NoError(t, store.GetCtx(context.Background(), &dataToGet, pathvar, Fields("Name", "Child.Count", "Records.Name")))
+	assert.Equal(t, TestMasked{
+		Name:    "test",
+		Child:   TestMaskedChild{Count: 3},
+		Records: []TestRecord{{Name: SetString("first")}},
+	}, dataToGet)
+
+	require.NoError(t, store.Delete(context.Background(), &TestMasked{}, pathvar, Fields("Name", "Records")))
+	dataToGet = TestMasked{}
+	require.NoError(t, store.GetCtx(context.Background(), &dataToGet, pathvar, Fields("Name", "Child", "Records")))
+	assert.Equal(t, TestMasked{Child: TestMaskedChild{Flag: true, Count: 3}, Records: []TestRecord{}}, dataToGet)
+
+	err = store.GetCtx(context.Background(), &dataToGet, pathvar, Fields("Missing"))
+	assert.True(t, errors.Is(err, ErrInvalidModel))
+}
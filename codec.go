@@ -0,0 +1,306 @@
+package etcdclient
+
+import (
+	"encoding"
+	"encoding/base64"
+	"net/url"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Codec encodes the values of a Go type to etcd values and back. It lets
+// model fields use ordinary types instead of implementing EtcdValue
+type Codec interface {
+	// Encode returns the etcd value for v, which holds a value of the type
+	// the codec is registered for
+	Encode(v interface{}) (string, error)
+	// Decode stores the value decoded from data in v, a pointer to a value of
+	// the type the codec is registered for
+	Decode(data string, v interface{}) error
+}
+
+// CodecFuncs adapts a pair of functions to a Codec
+type CodecFuncs struct {
+	EncodeFunc func(v interface{}) (string, error)
+	DecodeFunc func(data string, v interface{}) error
+}
+
+func (c CodecFuncs) Encode(v interface{}) (string, error) {
+	return c.EncodeFunc(v)
+}
+
+func (c CodecFuncs) Decode(data string, v interface{}) error {
+	return c.DecodeFunc(data, v)
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[reflect.Type]Codec{}
+)
+
+// RegisterCodec registers the codec used for fields of type t, and pointers
+// to t. It replaces the codec previously registered for t
+func RegisterCodec(t reflect.Type, c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[t] = c
+}
+
+var (
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+	urlType             = reflect.TypeOf(url.URL{})
+	uuidType            = reflect.TypeOf(uuid.UUID{})
+	bytesType           = reflect.TypeOf([]byte(nil))
+)
+
+// codecFor returns the codec for values of type t: a registered codec, the
+// type's text marshaling methods or the built in codec for its kind. It
+// returns nil for types without one
+func codecFor(t reflect.Type) Codec {
+	codecsMu.RLock()
+	c, ok := codecs[t]
+	codecsMu.RUnlock()
+	if ok {
+		return c
+	}
+
+	switch {
+	case t == timeType:
+		return timeCodec
+	case t == durationType:
+		return durationCodec
+	case t == urlType:
+		return urlCodec
+	case t == uuidType:
+		return uuidCodec
+	case t == bytesType:
+		return bytesCodec
+	case reflect.PtrTo(t).Implements(textMarshalerType) && reflect.PtrTo(t).Implements(textUnmarshalerType):
+		return textCodec
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return stringCodec
+	case reflect.Bool:
+		return boolCodec
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return intCodec
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return uintCodec
+	case reflect.Float32, reflect.Float64:
+		return floatCodec
+	}
+	return nil
+}
+
+// plainCodec returns the codec of a field that holds an ordinary Go value,
+// or a pointer to one, instead of an EtcdValue. It returns nil for other
+// fields
+func plainCodec(t reflect.Type) Codec {
+	if t.Implements(etcdValueType) {
+		return nil
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return codecFor(t)
+}
+
+// isUUIDField reports whether a field of type t holds UUIDs, alone or as the
+// elements of a slice or map
+func isUUIDField(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	return t == uuidType || t == reflect.TypeOf(EtcdUuid("")) || t == reflect.TypeOf(Value[uuid.UUID]{})
+}
+
+// encodeValue encodes the value held by a plain field. ok is false for nil
+// pointers, which are not written
+func encodeValue(c Codec, field reflect.Value) (string, bool, error) {
+	if field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			return "", false, nil
+		}
+		field = field.Elem()
+	}
+	data, err := c.Encode(field.Interface())
+	return data, true, err
+}
+
+// decodeValue decodes data into a plain field, allocating pointers
+func decodeValue(c Codec, data string, field reflect.Value) error {
+	t := field.Type()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	val := reflect.New(t)
+	if err := c.Decode(data, val.Interface()); err != nil {
+		return err
+	}
+	if field.Kind() == reflect.Ptr {
+		field.Set(val)
+	} else {
+		field.Set(val.Elem())
+	}
+	return nil
+}
+
+// The built in codecs use the same formats as the EtcdValue types
+var (
+	stringCodec = CodecFuncs{
+		EncodeFunc: func(v interface{}) (string, error) {
+			return reflect.ValueOf(v).String(), nil
+		},
+		DecodeFunc: func(data string, v interface{}) error {
+			reflect.ValueOf(v).Elem().SetString(data)
+			return nil
+		},
+	}
+	boolCodec = CodecFuncs{
+		EncodeFunc: func(v interface{}) (string, error) {
+			return strconv.FormatBool(reflect.ValueOf(v).Bool()), nil
+		},
+		DecodeFunc: func(data string, v interface{}) error {
+			b, err := strconv.ParseBool(data)
+			if err != nil {
+				return err
+			}
+			reflect.ValueOf(v).Elem().SetBool(b)
+			return nil
+		},
+	}
+	intCodec = CodecFuncs{
+		EncodeFunc: func(v interface{}) (string, error) {
+			return strconv.FormatInt(reflect.ValueOf(v).Int(), 10), nil
+		},
+		DecodeFunc: func(data string, v interface{}) error {
+			elem := reflect.ValueOf(v).Elem()
+			i, err := strconv.ParseInt(data, 10, elem.Type().Bits())
+			if err != nil {
+				return err
+			}
+			elem.SetInt(i)
+			return nil
+		},
+	}
+	uintCodec = CodecFuncs{
+		EncodeFunc: func(v interface{}) (string, error) {
+			return strconv.FormatUint(reflect.ValueOf(v).Uint(), 10), nil
+		},
+		DecodeFunc: func(data string, v interface{}) error {
+			elem := reflect.ValueOf(v).Elem()
+			u, err := strconv.ParseUint(data, 10, elem.Type().Bits())
+			if err != nil {
+				return err
+			}
+			elem.SetUint(u)
+			return nil
+		},
+	}
+	floatCodec = CodecFuncs{
+		EncodeFunc: func(v interface{}) (string, error) {
+			val := reflect.ValueOf(v)
+			return strconv.FormatFloat(val.Float(), 'g', -1, val.Type().Bits()), nil
+		},
+		DecodeFunc: func(data string, v interface{}) error {
+			elem := reflect.ValueOf(v).Elem()
+			f, err := strconv.ParseFloat(data, elem.Type().Bits())
+			if err != nil {
+				return err
+			}
+			elem.SetFloat(f)
+			return nil
+		},
+	}
+	timeCodec = CodecFuncs{
+		EncodeFunc: func(v interface{}) (string, error) {
+			return v.(time.Time).Format(time.RFC3339Nano), nil
+		},
+		DecodeFunc: func(data string, v interface{}) error {
+			t, err := time.Parse(time.RFC3339Nano, data)
+			if err != nil {
+				return err
+			}
+			*v.(*time.Time) = t
+			return nil
+		},
+	}
+	durationCodec = CodecFuncs{
+		EncodeFunc: func(v interface{}) (string, error) {
+			return v.(time.Duration).String(), nil
+		},
+		DecodeFunc: func(data string, v interface{}) error {
+			d, err := time.ParseDuration(data)
+			if err != nil {
+				return err
+			}
+			*v.(*time.Duration) = d
+			return nil
+		},
+	}
+	urlCodec = CodecFuncs{
+		EncodeFunc: func(v interface{}) (string, error) {
+			u := v.(url.URL)
+			return u.String(), nil
+		},
+		DecodeFunc: func(data string, v interface{}) error {
+			u, err := parseURL(data)
+			if err != nil {
+				return err
+			}
+			*v.(*url.URL) = *u
+			return nil
+		},
+	}
+	uuidCodec = CodecFuncs{
+		EncodeFunc: func(v interface{}) (string, error) {
+			return v.(uuid.UUID).String(), nil
+		},
+		DecodeFunc: func(data string, v interface{}) error {
+			u, err := parseUUID(data)
+			if err != nil {
+				return err
+			}
+			*v.(*uuid.UUID) = u
+			return nil
+		},
+	}
+	bytesCodec = CodecFuncs{
+		EncodeFunc: func(v interface{}) (string, error) {
+			return base64.RawURLEncoding.EncodeToString(v.([]byte)), nil
+		},
+		DecodeFunc: func(data string, v interface{}) error {
+			b, err := base64.RawURLEncoding.DecodeString(data)
+			if err != nil {
+				return err
+			}
+			*v.(*[]byte) = b
+			return nil
+		},
+	}
+	textCodec = CodecFuncs{
+		EncodeFunc: func(v interface{}) (string, error) {
+			m, ok := v.(encoding.TextMarshaler)
+			if !ok {
+				// MarshalText has a pointer receiver
+				p := reflect.New(reflect.TypeOf(v))
+				p.Elem().Set(reflect.ValueOf(v))
+				m = p.Interface().(encoding.TextMarshaler)
+			}
+			b, err := m.MarshalText()
+			return string(b), err
+		},
+		DecodeFunc: func(data string, v interface{}) error {
+			return v.(encoding.TextUnmarshaler).UnmarshalText([]byte(data))
+		},
+	}
+)
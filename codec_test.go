@@ -0,0 +1,152 @@
+package etcdclient
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+)
+
+type TestColor string
+
+type TestUpper string
+
+type TestPlain struct {
+	Name    string     `path:"/path/:var/name"`
+	Count   int64      `path:"/path/:var/count"`
+	Ratio   *float64   `path:"/path/:var/ratio"`
+	Created time.Time  `path:"/path/:var/created"`
+	Data    []byte     `path:"/path/:var/data"`
+	Addr    net.IP     `path:"/path/:var/addr"`
+	Color   *TestColor `path:"/path/:var/color"`
+	Legacy  *EtcdInt   `path:"/path/:var/legacy"`
+}
+
+func init() {
+	RegisterCodec(reflect.TypeOf(TestUpper("")), CodecFuncs{
+		EncodeFunc: func(v interface{}) (string, error) {
+			return strings.ToUpper(string(v.(TestUpper))), nil
+		},
+		DecodeFunc: func(data string, v interface{}) error {
+			*v.(*TestUpper) = TestUpper(strings.ToLower(data))
+			return nil
+		},
+	})
+}
+
+func TestCodecs(t *testing.T) {
+	ratio := 0.25
+	cases := []struct {
+		name     string
+		value    interface{}
+		expected string
+	}{
+		{name: "string", value: "test", expected: "test"},
+		{name: "named_string", value: TestColor("red"), expected: "red"},
+		{name: "int", value: int64(-42), expected: "-42"},
+		{name: "int8", value: int8(-8), expected: "-8"},
+		{name: "uint", value: uint16(42), expected: "42"},
+		{name: "float", value: ratio, expected: "0.25"},
+		{name: "bool", value: true, expected: "true"},
+		{name: "time", value: testTime, expected: "2018-08-30T12:00:00Z"},
+		{name: "duration", value: 90 * time.Second, expected: "1m30s"},
+		{name: "url", value: url.URL{Scheme: "https", Host: "example.com", Path: "/a"}, expected: "https://example.com/a"},
+		{name: "bytes", value: []byte("test"), expected: "dGVzdA"},
+		{name: "text_marshaler", value: net.ParseIP("10.0.0.1"), expected: "10.0.0.1"},
+		{name: "registered", value: TestUpper("abc"), expected: "ABC"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			codec := codecFor(reflect.TypeOf(tc.value))
+			require.NotNil(t, codec)
+
+			data, err := codec.Encode(tc.value)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, data)
+
+			decoded := reflect.New(reflect.TypeOf(tc.value))
+			require.NoError(t, codec.Decode(data, decoded.Interface()))
+			assert.Equal(t, tc.value, decoded.Elem().Interface())
+		})
+	}
+}
+
+func TestCodecDecodeErrors(t *testing.T) {
+	var i8 int8
+	assert.Error(t, codecFor(reflect.TypeOf(i8)).Decode("300", &i8))
+	var b bool
+	assert.Error(t, codecFor(reflect.TypeOf(b)).Decode("maybe", &b))
+	assert.Nil(t, codecFor(reflect.TypeOf(struct{}{})))
+	assert.Nil(t, plainCodec(reflect.TypeOf(SetInt(1))))
+}
+
+func TestPlainFieldOps(t *testing.T) {
+	color := TestColor("red")
+	model := TestPlain{
+		Name:    "test",
+		Count:   42,
+		Created: testTime,
+		Color:   &color,
+	}
+	pathvar := map[string]string{"@": "", "var": "sub"}
+
+	// Plain values are always written, nil pointers are skipped
+	etcdOps, err := createStructSetOps(reflect.ValueOf(model), "TestPlain", pathvar, false, newSetPlan(nil, nil))
+	require.NoError(t, err)
+	puts := map[string]string{}
+	for _, op := range etcdOps {
+		puts[string(op.KeyBytes())] = string(op.ValueBytes())
+	}
+	assert.Equal(t, map[string]string{
+		"/path/sub/name":    "test",
+		"/path/sub/count":   "42",
+		"/path/sub/created": "2018-08-30T12:00:00Z",
+		"/path/sub/data":    "",
+		"/path/sub/addr":    "",
+		"/path/sub/color":   "red",
+	}, puts)
+
+	// Plain fields are always read, the EtcdValue only when requested
+	dataToGet := TestPlain{}
+	etcdOps, callbacks, err := createStructGetOps(reflect.ValueOf(&dataToGet).Elem(), "TestPlain", pathvar, false, nil)
+	require.NoError(t, err)
+	require.Len(t, etcdOps, 7)
+
+	responses := map[string]string{
+		"/path/sub/name":    "test",
+		"/path/sub/count":   "42",
+		"/path/sub/ratio":   "0.5",
+		"/path/sub/created": "2018-08-30T12:00:00Z",
+		"/path/sub/addr":    "10.0.0.1",
+	}
+	for i, op := range etcdOps {
+		key := string(op.KeyBytes())
+		if value, ok := responses[key]; ok {
+			require.NoError(t, callbacks[i](rangeResponse(&mvccpb.KeyValue{Key: []byte(key), Value: []byte(value)})))
+		} else {
+			require.NoError(t, callbacks[i](rangeResponse()))
+		}
+	}
+
+	ratio := 0.5
+	assert.Equal(t, TestPlain{
+		Name:    "test",
+		Count:   42,
+		Ratio:   &ratio,
+		Created: testTime,
+		Addr:    net.ParseIP("10.0.0.1"),
+	}, dataToGet)
+
+	_, callbacks, err = createStructGetOps(reflect.ValueOf(&dataToGet).Elem(), "TestPlain", pathvar, false, nil)
+	require.NoError(t, err)
+	err = callbacks[1](rangeResponse(&mvccpb.KeyValue{Key: []byte("/path/sub/count"), Value: []byte("many")}))
+	assert.True(t, errors.Is(err, ErrDecode))
+}
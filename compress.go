@@ -0,0 +1,185 @@
+package etcdclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression algorithms selected with WithCompression or the compress tag
+// option
+const (
+	// CompressionNone stores values uncompressed. On a field it overrides the
+	// store's compression
+	CompressionNone = "none"
+	// CompressionGzip compresses values with gzip
+	CompressionGzip = "gzip"
+	// CompressionZstd compresses values with zstd
+	CompressionZstd = "zstd"
+	// CompressionSnappy compresses values with snappy
+	CompressionSnappy = "snappy"
+)
+
+// WithCompression compresses every value the store writes with algorithm,
+// unless the field's compress tag option selects another one. Values are
+// only stored compressed when that makes them smaller, and values written
+// without compression are still read as they are
+func WithCompression(algorithm string) Option {
+	return func(o *options) {
+		o.compression = algorithm
+	}
+}
+
+// compressionMagic starts every compressed value. It is followed by a byte
+// naming the algorithm and the compressed data
+const compressionMagic = "\x00ecz"
+
+// Algorithm bytes of compressed values. compressionStored marks a value
+// stored as it is because it starts with compressionMagic
+const (
+	compressionStored byte = iota
+	compressionGzipID
+	compressionZstdID
+	compressionSnappyID
+)
+
+const (
+	// compressionMinSize is the size below which values are not compressed
+	compressionMinSize = 64
+	// maxDecompressedSize bounds the size of decompressed values
+	maxDecompressedSize = 64 << 20
+)
+
+// checkCompression verifies algorithm names a compression algorithm
+func checkCompression(algorithm string) error {
+	switch algorithm {
+	case CompressionNone, CompressionGzip, CompressionZstd, CompressionSnappy:
+		return nil
+	}
+	return fmt.Errorf("unknown compression algorithm %q", algorithm)
+}
+
+// compressValue compresses data with algorithm when that makes it smaller.
+// Data that would be mistaken for a compressed value is stored behind a
+// header even when it is not compressed
+func compressValue(data string, algorithm string) (string, error) {
+	if algorithm != "" && algorithm != CompressionNone && len(data) >= compressionMinSize {
+		id, compressed, err := compress(algorithm, []byte(data))
+		if err != nil {
+			return "", err
+		}
+		if len(compressionMagic)+1+len(compressed) < len(data) {
+			return compressionMagic + string(id) + string(compressed), nil
+		}
+	}
+	if strings.HasPrefix(data, compressionMagic) {
+		return compressionMagic + string(compressionStored) + data, nil
+	}
+	return data, nil
+}
+
+// compress compresses data with algorithm and returns the algorithm byte
+// stored with it
+func compress(algorithm string, data []byte) (byte, []byte, error) {
+	switch algorithm {
+	case CompressionGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return 0, nil, err
+		}
+		if err := w.Close(); err != nil {
+			return 0, nil, err
+		}
+		return compressionGzipID, buf.Bytes(), nil
+	case CompressionZstd:
+		enc, _, err := zstdCodecs()
+		if err != nil {
+			return 0, nil, err
+		}
+		return compressionZstdID, enc.EncodeAll(data, nil), nil
+	case CompressionSnappy:
+		return compressionSnappyID, snappy.Encode(nil, data), nil
+	}
+	return 0, nil, fmt.Errorf("unknown compression algorithm %q", algorithm)
+}
+
+// decompressValue returns data decompressed if it starts with
+// compressionMagic, and as it is otherwise
+func decompressValue(data string) (string, error) {
+	if !strings.HasPrefix(data, compressionMagic) {
+		return data, nil
+	}
+	if len(data) == len(compressionMagic) {
+		return "", fmt.Errorf("compressed value is truncated")
+	}
+	id, compressed := data[len(compressionMagic)], data[len(compressionMagic)+1:]
+
+	switch id {
+	case compressionStored:
+		return compressed, nil
+	case compressionGzipID:
+		r, err := gzip.NewReader(strings.NewReader(compressed))
+		if err != nil {
+			return "", err
+		}
+		b, err := io.ReadAll(io.LimitReader(r, maxDecompressedSize+1))
+		if err != nil {
+			return "", err
+		}
+		if len(b) > maxDecompressedSize {
+			return "", fmt.Errorf("decompressed value is larger than %d bytes", maxDecompressedSize)
+		}
+		return string(b), nil
+	case compressionZstdID:
+		_, dec, err := zstdCodecs()
+		if err != nil {
+			return "", err
+		}
+		b, err := dec.DecodeAll([]byte(compressed), nil)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	case compressionSnappyID:
+		n, err := snappy.DecodedLen([]byte(compressed))
+		if err != nil {
+			return "", err
+		}
+		if n > maxDecompressedSize {
+			return "", fmt.Errorf("decompressed value is larger than %d bytes", maxDecompressedSize)
+		}
+		b, err := snappy.Decode(nil, []byte(compressed))
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+	return "", fmt.Errorf("unknown compression algorithm %d", id)
+}
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+	zstdErr     error
+)
+
+// zstdCodecs returns the zstd encoder and decoder shared by all values,
+// creating them on first use
+func zstdCodecs() (*zstd.Encoder, *zstd.Decoder, error) {
+	zstdOnce.Do(func() {
+		zstdEncoder, zstdErr = zstd.NewWriter(nil)
+		if zstdErr != nil {
+			return
+		}
+		zstdDecoder, zstdErr = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxDecompressedSize))
+	})
+	return zstdEncoder, zstdDecoder, zstdErr
+}
@@ -0,0 +1,181 @@
+package etcdclient
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+)
+
+type TestCompressed struct {
+	Config *EtcdJSON   `path:"/path/:var/config"`
+	Blob   []byte      `path:"/path/:var/blob,compress=gzip"`
+	Notes  *EtcdString `path:"/path/:var/notes,compress=none"`
+	Tags   []string    `path:"/path/:var/tags"`
+}
+
+func TestCompressRoundTrip(t *testing.T) {
+	large := strings.Repeat(`{"name": "value"}`, 100)
+	random := make([]byte, 256)
+	_, err := rand.Read(random)
+	require.NoError(t, err)
+
+	cases := []struct {
+		name               string
+		data               string
+		algorithm          string
+		expectedCompressed bool
+	}{
+		{name: "gzip", data: large, algorithm: CompressionGzip, expectedCompressed: true},
+		{name: "zstd", data: large, algorithm: CompressionZstd, expectedCompressed: true},
+		{name: "snappy", data: large, algorithm: CompressionSnappy, expectedCompressed: true},
+		{name: "none", data: large, algorithm: CompressionNone},
+		{name: "unset", data: large},
+		{name: "small", data: `{"name": "value"}`, algorithm: CompressionZstd},
+		{name: "incompressible", data: string(random), algorithm: CompressionGzip},
+		{name: "empty", algorithm: CompressionGzip},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			value, err := compressValue(tc.data, tc.algorithm)
+			require.NoError(t, err)
+			if tc.expectedCompressed {
+				assert.True(t, strings.HasPrefix(value, compressionMagic))
+				assert.Less(t, len(value), len(tc.data))
+			} else {
+				assert.Equal(t, tc.data, value)
+			}
+
+			data, err := decompressValue(value)
+			require.NoError(t, err)
+			assert.Equal(t, tc.data, data)
+		})
+	}
+}
+
+func TestCompressMagicPrefix(t *testing.T) {
+	// Uncompressed data starting like a compressed value keeps a header so it
+	// reads back as it was written
+	for _, algorithm := range []string{"", CompressionNone, CompressionZstd} {
+		value, err := compressValue(compressionMagic+"\x01data", algorithm)
+		require.NoError(t, err)
+		assert.Equal(t, compressionMagic+"\x00"+compressionMagic+"\x01data", value)
+
+		data, err := decompressValue(value)
+		require.NoError(t, err)
+		assert.Equal(t, compressionMagic+"\x01data", data)
+	}
+}
+
+func TestDecompressErrors(t *testing.T) {
+	compressed, err := compressValue(strings.Repeat("value", 100), CompressionGzip)
+	require.NoError(t, err)
+
+	cases := []struct {
+		name string
+		data string
+	}{
+		{name: "truncated_header", data: compressionMagic},
+		{name: "unknown_algorithm", data: compressionMagic + "\x09data"},
+		{name: "corrupt_gzip", data: compressionMagic + "\x01data"},
+		{name: "corrupt_zstd", data: compressionMagic + "\x02data"},
+		{name: "corrupt_snappy", data: compressionMagic + "\x03data"},
+		{name: "truncated_gzip", data: compressed[:len(compressed)-8]},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := decompressValue(tc.data)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestCompressedFieldOps(t *testing.T) {
+	entries := []map[string]string{}
+	for i := 0; i < 50; i++ {
+		entries = append(entries, map[string]string{"name": "value"})
+	}
+	config, err := SetJSON(entries)
+	require.NoError(t, err)
+	model := TestCompressed{
+		Config: config,
+		Blob:   []byte(strings.Repeat("blob", 100)),
+		Notes:  SetString(strings.Repeat("note", 100)),
+	}
+	pathvar := map[string]string{"@": "", "var": "sub"}
+	s := &store{compression: CompressionZstd, signingKeys: newTestKeys()}
+
+	etcdOps, err := createStructSetOps(reflect.ValueOf(model), "TestCompressed", pathvar, false, newSetPlan(context.Background(), s))
+	require.NoError(t, err)
+	require.Len(t, etcdOps, 3)
+	values := []string{}
+	for _, op := range etcdOps {
+		data, err := verifyValue(context.Background(), s.signingKeys, string(op.KeyBytes()), string(op.ValueBytes()))
+		require.NoError(t, err)
+		values = append(values, data)
+	}
+	assert.Equal(t, compressionMagic+"\x02", values[0][:len(compressionMagic)+1])
+	assert.Equal(t, compressionMagic+"\x01", values[1][:len(compressionMagic)+1])
+	assert.Equal(t, strings.Repeat("note", 100), values[2])
+
+	dataToGet := TestCompressed{Config: GetJSON(), Blob: []byte{}, Notes: GetString()}
+	plan := &getPlan{ctx: context.Background(), store: s}
+	_, callbacks, err := createStructGetOps(reflect.ValueOf(&dataToGet).Elem(), "TestCompressed", pathvar, false, plan)
+	require.NoError(t, err)
+	require.Len(t, callbacks, 3)
+	for i, op := range etcdOps {
+		require.NoError(t, callbacks[i](rangeResponse(&mvccpb.KeyValue{Key: op.KeyBytes(), Value: op.ValueBytes()})))
+	}
+	assert.Equal(t, model, dataToGet)
+
+	// Values written before compression was enabled read as they are
+	dataToGet = TestCompressed{Notes: GetString()}
+	legacy := &getPlan{ctx: context.Background(), store: &store{compression: CompressionZstd}}
+	_, callbacks, err = createStructGetOps(reflect.ValueOf(&dataToGet).Elem(), "TestCompressed", pathvar, false, legacy)
+	require.NoError(t, err)
+	require.Len(t, callbacks, 2)
+	require.NoError(t, callbacks[1](rangeResponse(&mvccpb.KeyValue{Key: []byte("/path/sub/notes"), Value: []byte("legacy")})))
+	assert.Equal(t, SetString("legacy"), dataToGet.Notes)
+
+	err = callbacks[1](rangeResponse(&mvccpb.KeyValue{Key: []byte("/path/sub/notes"), Value: []byte(compressionMagic + "\x09")}))
+	assert.True(t, errors.Is(err, ErrDecode))
+}
+
+func TestCompressStructFields(t *testing.T) {
+	pathvar := map[string]string{"@": "", "var": "sub"}
+
+	child := struct {
+		Child TestMaskedChild `path:"/path/:var/child,compress=gzip"`
+	}{}
+	_, err := createStructSetOps(reflect.ValueOf(child), "TestCompressed", pathvar, false, newSetPlan(nil, nil))
+	assert.True(t, errors.Is(err, ErrInvalidModel))
+
+	records := struct {
+		Records []TestRecord `path:"/path/:var/records,compress=gzip"`
+	}{Records: []TestRecord{{Name: SetString("name")}}}
+	_, err = createStructSetOps(reflect.ValueOf(records), "TestCompressed", pathvar, false, newSetPlan(nil, nil))
+	assert.True(t, errors.Is(err, ErrInvalidModel))
+
+	// Hashed element IDs are the same with and without compression
+	type element struct {
+		Value *EtcdString `path:":@/value"`
+	}
+	elements := struct {
+		Elements []element `path:"/path/:var/elements,id=hash"`
+	}{Elements: []element{{Value: SetString(strings.Repeat("value", 100))}}}
+	plain, err := createStructSetOps(reflect.ValueOf(elements), "TestCompressed", pathvar, false, newSetPlan(nil, nil))
+	require.NoError(t, err)
+	compressed, err := createStructSetOps(reflect.ValueOf(elements), "TestCompressed", pathvar, false, newSetPlan(nil, &store{compression: CompressionGzip}))
+	require.NoError(t, err)
+	require.Len(t, compressed, 1)
+	assert.Equal(t, string(plain[0].KeyBytes()), string(compressed[0].KeyBytes()))
+	assert.NotEqual(t, string(plain[0].ValueBytes()), string(compressed[0].ValueBytes()))
+}
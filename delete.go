@@ -0,0 +1,94 @@
+package etcdclient
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+)
+
+// Delete deletes the keys of the tagged fields of d, or of the fields selected
+// with Fields. Slice and map fields are deleted with all their elements, and
+// struct fields with all the fields below them. The values held by d are not
+// used
+func (c *store) Delete(ctx context.Context, d interface{}, pathvar map[string]string, opts ...OpOption) error {
+	if err := validateInterface(d); err != nil {
+		err = &Error{Kind: ErrInvalidModel, Err: err}
+		c.logger.Error("Error validating interface", zap.Error(err))
+		return err
+	}
+	modelType := reflect.TypeOf(d).Elem()
+	pathvar["@"] = ""
+
+	o := newOpOptions(opts...)
+	mask := newFieldMask(o.fields)
+	if err := mask.check(modelType); err != nil {
+		c.logger.Error("Error validating fields", zap.Error(err))
+		return err
+	}
+
+	ctx, cancel := c.requestContext(ctx)
+	defer cancel()
+
+	_, err := c.setWithRetries(ctx, o, func(plan *setPlan) ([]clientv3.Op, error) {
+		plan.mask = mask
+		return createStructDeleteOps(modelType, modelType.Name(), pathvar, plan)
+	})
+	return err
+}
+
+// createStructDeleteOps builds the delete ops for the tagged fields of struct
+// type t that the plan's mask selects
+func createStructDeleteOps(t reflect.Type, fieldPath string, pathvar map[string]string, plan *setPlan) ([]clientv3.Op, error) {
+	etcdOps := []clientv3.Op{}
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		fieldName := fieldPath + "." + sf.Name
+		tag, ok := sf.Tag.Lookup(tagKey)
+		if !ok {
+			continue
+		}
+
+		selected := true
+		if mask := plan.fieldMask(); mask != nil {
+			var below bool
+			selected, below = mask.match(fieldName)
+			if !selected && !below {
+				continue
+			}
+		}
+
+		path, _, err := parseTag(tag)
+		if err != nil {
+			return nil, withField(err, fieldName)
+		}
+		etcdKey, err := pathReplace(path, pathvar, false)
+		if err != nil {
+			return nil, withField(err, fieldName)
+		}
+
+		switch {
+		case sf.Type.Kind() == reflect.Struct && plainCodec(sf.Type) == nil:
+			parent := pathvar["@"]
+			pathvar["@"] = etcdKey
+			newOps, err := createStructDeleteOps(sf.Type, fieldName, pathvar, plan)
+			pathvar["@"] = parent
+			if err != nil {
+				return nil, err
+			}
+			etcdOps = append(etcdOps, newOps...)
+		case !selected:
+			// Only the fields of elements are below slice and map fields
+			return nil, &Error{Kind: ErrInvalidModel, Field: fieldName, Key: etcdKey, Err: fmt.Errorf("fields of elements cannot be deleted, use DeleteElement or delete the whole field")}
+		case sf.Type.Kind() == reflect.Map || sf.Type.Kind() == reflect.Slice && plainCodec(sf.Type) == nil:
+			etcdOps = append(etcdOps, plan.record(fieldName, clientv3.OpDelete(etcdKey+"/", clientv3.WithPrefix())))
+		default:
+			etcdOps = append(etcdOps, plan.record(fieldName, clientv3.OpDelete(etcdKey)))
+		}
+	}
+
+	return etcdOps, nil
+}
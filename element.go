@@ -0,0 +1,283 @@
+package etcdclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+)
+
+// ElementIdentifier is implemented by slice elements that choose the ID
+// they are stored under, e.g. from a natural key of the element
+type ElementIdentifier interface {
+	ElementID() string
+}
+
+// elementIDSetter is implemented by slice elements that record the ID they
+// were read or written under
+type elementIDSetter interface {
+	SetElementID(id string)
+}
+
+// Element can be embedded in the structs of a slice to keep the ID each
+// element is stored under. Get records the ID of every element read, and Set
+// writes an element back under the same ID instead of adding a new one
+type Element struct {
+	id string
+}
+
+// ElementID returns the ID the element is stored under, empty for elements
+// that were not stored yet
+func (e *Element) ElementID() string {
+	return e.id
+}
+
+// SetElementID sets the ID the element is stored under
+func (e *Element) SetElementID(id string) {
+	e.id = id
+}
+
+// checkElementID verifies an element ID is a single non-empty path segment
+func checkElementID(id string, fieldPath string) error {
+	if id == "" || strings.Contains(id, "/") {
+		return &Error{Kind: ErrInvalidModel, Field: fieldPath, Err: fmt.Errorf("element IDs must be a single non-empty path segment")}
+	}
+	return nil
+}
+
+// carriedElementID returns the ID a struct element carries, if any
+func carriedElementID(elem reflect.Value) string {
+	if elem.CanAddr() {
+		elem = elem.Addr()
+	}
+	if e, ok := elem.Interface().(ElementIdentifier); ok {
+		return e.ElementID()
+	}
+	return ""
+}
+
+// recordElementID stores id in a struct element that records its ID
+func recordElementID(elem reflect.Value, id string) {
+	if !elem.CanAddr() {
+		return
+	}
+	if e, ok := elem.Addr().Interface().(elementIDSetter); ok {
+		e.SetElementID(id)
+	}
+}
+
+// idGenerator generates the IDs of the new elements of a single slice field
+// with the generator selected by its tag options
+type idGenerator struct {
+	tagOpts tagOptions
+	plan    *setPlan
+	field   string
+	prefix  string
+	// seq is the next sequence number of an ordered list, read from etcd
+	// when the first ID is generated
+	seq     uint64
+	seqRead bool
+}
+
+func newIDGenerator(fieldPath string, etcdKey string, tagOpts tagOptions, plan *setPlan) *idGenerator {
+	return &idGenerator{
+		tagOpts: tagOpts,
+		plan:    plan,
+		field:   fieldPath,
+		prefix:  etcdKey + "/",
+	}
+}
+
+// next returns the ID of the next new element. content encodes the element
+// for content hashes
+func (g *idGenerator) next(content func() (string, error)) (string, error) {
+	switch {
+	case g.tagOpts.ordered:
+		// A replaced list starts over at the first sequence number
+		if !g.seqRead && !g.tagOpts.replace {
+			seq, err := g.plan.nextSequence(g.field, g.prefix)
+			if err != nil {
+				return "", err
+			}
+			g.seq, g.seqRead = seq, true
+		}
+		id := sequenceID(g.seq)
+		g.seq++
+		return id, nil
+	case g.tagOpts.id == idHash:
+		c, err := content()
+		if err != nil {
+			return "", err
+		}
+		sum := sha256.Sum256([]byte(c))
+		return hex.EncodeToString(sum[:16]), nil
+	default:
+		return GenerateUniqueID(), nil
+	}
+}
+
+// structContent encodes the values a struct element puts, relative to its
+// key, for content hashes
+func structContent(elem reflect.Value, fieldPath string, pathvar map[string]string, plan *setPlan) (string, error) {
+	scratch := &setPlan{ctx: plan.ctx, store: plan.store, leases: plan.leases, fields: map[string]string{}, hashing: true}
+	etcdOps, err := createStructSetOps(elem, fieldPath, elementPathvar(pathvar, ""), false, scratch)
+	if err != nil {
+		return "", err
+	}
+
+	puts := []string{}
+	for _, op := range etcdOps {
+		if op.IsPut() {
+			puts = append(puts, string(op.KeyBytes())+"\x00"+string(op.ValueBytes()))
+		}
+	}
+	sort.Strings(puts)
+	return strings.Join(puts, "\x00"), nil
+}
+
+// elementField resolves the slice field at the Go path field of model, e.g.
+// Child.Records, and returns its type and key
+func elementField(model reflect.Type, field string, pathvar map[string]string) (reflect.Type, string, tagOptions, error) {
+	fieldPath := model.Name()
+	names := strings.Split(field, ".")
+	for i, name := range names {
+		fieldPath += "." + name
+		sf, ok := model.FieldByName(name)
+		if !ok {
+			return nil, "", tagOptions{}, &Error{Kind: ErrInvalidModel, Field: fieldPath, Err: fmt.Errorf("no such field")}
+		}
+		tag, ok := sf.Tag.Lookup(tagKey)
+		if !ok {
+			return nil, "", tagOptions{}, &Error{Kind: ErrInvalidModel, Field: fieldPath, Err: fmt.Errorf("field has no path tag")}
+		}
+		path, tagOpts, err := parseTag(tag)
+		if err != nil {
+			return nil, "", tagOptions{}, withField(err, fieldPath)
+		}
+		etcdKey, err := pathReplace(path, pathvar, false)
+		if err != nil {
+			return nil, "", tagOptions{}, withField(err, fieldPath)
+		}
+
+		if i == len(names)-1 {
+			if sf.Type.Kind() != reflect.Slice {
+				return nil, "", tagOptions{}, &Error{Kind: ErrInvalidModel, Field: fieldPath, Err: fmt.Errorf("field is not a slice")}
+			}
+			return sf.Type, etcdKey, tagOpts, nil
+		}
+		if sf.Type.Kind() != reflect.Struct {
+			return nil, "", tagOptions{}, &Error{Kind: ErrInvalidModel, Field: fieldPath, Err: fmt.Errorf("field is not a struct")}
+		}
+		model = sf.Type
+		pathvar = elementPathvar(pathvar, etcdKey)
+	}
+	return nil, "", tagOptions{}, &Error{Kind: ErrInvalidModel, Err: fmt.Errorf("no field given")}
+}
+
+// SetElement writes elem as the element stored under id of the slice field
+// of model, e.g. Records or Child.Records. Only the type and tags of model
+// are used. elem must be of the slice's element type
+func (c *store) SetElement(ctx context.Context, model interface{}, pathvar map[string]string, field string, id string, elem interface{}, opts ...OpOption) error {
+	if err := validateInterface(model); err != nil {
+		err = &Error{Kind: ErrInvalidModel, Err: err}
+		c.logger.Error("Error validating interface", zap.Error(err))
+		return err
+	}
+	modelType := reflect.TypeOf(model).Elem()
+	pathvar["@"] = ""
+
+	sliceType, etcdKey, tagOpts, err := elementField(modelType, field, pathvar)
+	if err != nil {
+		c.logger.Error("Error resolving field", zap.Error(err))
+		return err
+	}
+	elemName := fmt.Sprintf("%s.%s[%s]", modelType.Name(), field, id)
+	if err := checkElementID(id, elemName); err != nil {
+		return err
+	}
+
+	ctx, cancel := c.requestContext(ctx)
+	defer cancel()
+
+	_, err = c.setWithRetries(ctx, newOpOptions(opts...), func(plan *setPlan) ([]clientv3.Op, error) {
+		return elementOps(sliceType, elem, elemName, etcdKey+"/"+id, pathvar, tagOpts, plan)
+	})
+	return err
+}
+
+// elementOps builds the ops writing elem as the element of a slice of type
+// sliceType stored under elemKey
+func elementOps(sliceType reflect.Type, elem interface{}, elemName string, elemKey string, pathvar map[string]string, tagOpts tagOptions, plan *setPlan) ([]clientv3.Op, error) {
+	value := reflect.ValueOf(elem)
+	if !value.IsValid() || value.Type() != sliceType.Elem() {
+		return nil, &Error{Kind: ErrInvalidModel, Field: elemName, Err: fmt.Errorf("element is a %T, not a %s", elem, sliceType.Elem())}
+	}
+
+	if !isStructSlice(sliceType) {
+		iface, ok := elem.(EtcdValue)
+		if !ok || !iface.IsSet() {
+			return nil, &Error{Kind: ErrInvalidModel, Field: elemName, Err: fmt.Errorf("element must hold a value to set")}
+		}
+		op, err := putValue(plan, elemName, elemKey, iface, tagOpts)
+		if err != nil {
+			return nil, err
+		}
+		return []clientv3.Op{op}, nil
+	}
+
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil, &Error{Kind: ErrInvalidModel, Field: elemName, Err: fmt.Errorf("element cannot be nil")}
+		}
+		value = value.Elem()
+	}
+	etcdOps, err := createStructSetOps(value, elemName, elementPathvar(pathvar, elemKey), false, plan)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkElementOps(etcdOps, elemName, elemKey); err != nil {
+		return nil, err
+	}
+	return etcdOps, nil
+}
+
+// DeleteElement deletes the element stored under id of the slice field of
+// model, e.g. Records or Child.Records. Only the type and tags of model are
+// used
+func (c *store) DeleteElement(ctx context.Context, model interface{}, pathvar map[string]string, field string, id string, opts ...OpOption) error {
+	if err := validateInterface(model); err != nil {
+		err = &Error{Kind: ErrInvalidModel, Err: err}
+		c.logger.Error("Error validating interface", zap.Error(err))
+		return err
+	}
+	modelType := reflect.TypeOf(model).Elem()
+	pathvar["@"] = ""
+
+	sliceType, etcdKey, _, err := elementField(modelType, field, pathvar)
+	if err != nil {
+		c.logger.Error("Error resolving field", zap.Error(err))
+		return err
+	}
+	elemName := fmt.Sprintf("%s.%s[%s]", modelType.Name(), field, id)
+	if err := checkElementID(id, elemName); err != nil {
+		return err
+	}
+	elemKey := etcdKey + "/" + id
+
+	ctx, cancel := c.requestContext(ctx)
+	defer cancel()
+
+	_, err = c.setWithRetries(ctx, newOpOptions(opts...), func(plan *setPlan) ([]clientv3.Op, error) {
+		if isStructSlice(sliceType) {
+			return []clientv3.Op{plan.record(elemName, clientv3.OpDelete(elemKey+"/", clientv3.WithPrefix()))}, nil
+		}
+		return []clientv3.Op{plan.record(elemName, clientv3.OpDelete(elemKey))}, nil
+	})
+	return err
+}
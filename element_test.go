@@ -0,0 +1,152 @@
+package etcdclient
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+)
+
+type TestElement struct {
+	Element
+	Name *EtcdString `path:":@/name"`
+}
+
+type TestElements struct {
+	Elements []*TestElement `path:"/path/:var/elements"`
+	Hashed   []TestRecord   `path:"/path/:var/hashed,id=hash"`
+	Values   []*EtcdString  `path:"/path/:var/values"`
+	Tags     []*EtcdString  `path:"/path/:var/tags,id=hash"`
+	Child    TestRecords    `path:"/path/:var/child"`
+}
+
+func TestElementIDsKeptAcrossSets(t *testing.T) {
+	model := TestElements{
+		Elements: []*TestElement{{Name: SetString("first")}},
+	}
+	pathvar := map[string]string{"@": "", "var": "sub"}
+
+	etcdOps, err := createStructSetOps(reflect.ValueOf(&model).Elem(), "TestElements", pathvar, false, newSetPlan(nil, nil))
+	require.NoError(t, err)
+	require.Len(t, etcdOps, 1)
+
+	// The generated ID is recorded in the element and reused
+	id := model.Elements[0].ElementID()
+	require.NotEmpty(t, id)
+	assert.Equal(t, "/path/sub/elements/"+id+"/name", string(etcdOps[0].KeyBytes()))
+
+	model.Elements[0].Name = SetString("renamed")
+	etcdOps, err = createStructSetOps(reflect.ValueOf(&model).Elem(), "TestElements", pathvar, false, newSetPlan(nil, nil))
+	require.NoError(t, err)
+	assert.Equal(t, "/path/sub/elements/"+id+"/name", string(etcdOps[0].KeyBytes()))
+
+	// Caller supplied IDs are used as they are
+	model.Elements[0].SetElementID("named")
+	etcdOps, err = createStructSetOps(reflect.ValueOf(&model).Elem(), "TestElements", pathvar, false, newSetPlan(nil, nil))
+	require.NoError(t, err)
+	assert.Equal(t, "/path/sub/elements/named/name", string(etcdOps[0].KeyBytes()))
+
+	model.Elements[0].SetElementID("a/b")
+	_, err = createStructSetOps(reflect.ValueOf(&model).Elem(), "TestElements", pathvar, false, newSetPlan(nil, nil))
+	assert.True(t, errors.Is(err, ErrInvalidModel))
+}
+
+func TestElementIDsRecordedOnGet(t *testing.T) {
+	model := TestElements{
+		Elements: []*TestElement{{Name: GetString()}},
+	}
+
+	_, callbacks, err := createStructGetOps(reflect.ValueOf(&model).Elem(), "TestElements", map[string]string{"@": "", "var": "sub"}, false, nil)
+	require.NoError(t, err)
+	require.NoError(t, callbacks[0](rangeResponse(
+		&mvccpb.KeyValue{Key: []byte("/path/sub/elements/a/name"), Value: []byte("first")},
+		&mvccpb.KeyValue{Key: []byte("/path/sub/elements/b/name"), Value: []byte("second")},
+	)))
+
+	require.Len(t, model.Elements, 2)
+	assert.Equal(t, "a", model.Elements[0].ElementID())
+	assert.Equal(t, "b", model.Elements[1].ElementID())
+}
+
+func TestHashedElementIDs(t *testing.T) {
+	model := TestElements{
+		Hashed: []TestRecord{{Name: SetString("first")}, {Name: SetString("first")}, {Name: SetString("second")}},
+		Values: []*EtcdString{SetString("first"), SetString("second")},
+		Tags:   []*EtcdString{SetString("first"), SetString("first"), SetString("second")},
+	}
+
+	etcdOps, err := createStructSetOps(reflect.ValueOf(model), "TestElements", map[string]string{"@": "", "var": "sub"}, false, newSetPlan(nil, nil))
+	require.NoError(t, err)
+	require.Len(t, etcdOps, 8)
+	keys := []string{}
+	for _, op := range etcdOps {
+		keys = append(keys, string(op.KeyBytes()))
+	}
+
+	// Equal content is stored under the same key
+	assert.Equal(t, keys[0], keys[1])
+	assert.NotEqual(t, keys[0], keys[2])
+	assert.Equal(t, keys[5], keys[6])
+	assert.NotEqual(t, keys[5], keys[7])
+
+	// Every value is stored directly below the slice key
+	for _, key := range keys[3:5] {
+		assert.Equal(t, 1, strings.Count(strings.TrimPrefix(key, "/path/sub/values/"), "/")+1)
+	}
+	assert.NotEqual(t, keys[3], keys[4])
+}
+
+func TestElementField(t *testing.T) {
+	cases := []struct {
+		name         string
+		field        string
+		expectedKey  string
+		expectedType reflect.Type
+		expectedErr  error
+	}{
+		{
+			name:         "struct_slice",
+			field:        "Elements",
+			expectedKey:  "/path/sub/elements",
+			expectedType: reflect.TypeOf([]*TestElement{}),
+		},
+		{
+			name:         "nested",
+			field:        "Child.Records",
+			expectedKey:  "/path/sub/records",
+			expectedType: reflect.TypeOf([]TestRecord{}),
+		},
+		{
+			name:        "missing",
+			field:       "Missing",
+			expectedErr: ErrInvalidModel,
+		},
+		{
+			name:        "not_a_slice",
+			field:       "Child",
+			expectedErr: ErrInvalidModel,
+		},
+		{
+			name:        "not_a_struct",
+			field:       "Values.Name",
+			expectedErr: ErrInvalidModel,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sliceType, key, _, err := elementField(reflect.TypeOf(TestElements{}), tc.field, map[string]string{"@": "", "var": "sub"})
+			if tc.expectedErr != nil {
+				assert.True(t, errors.Is(err, tc.expectedErr))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedKey, key)
+			assert.Equal(t, tc.expectedType, sliceType)
+		})
+	}
+}
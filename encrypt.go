@@ -0,0 +1,194 @@
+package etcdclient
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// KeyProvider supplies the AES keys that encrypt the fields tagged with the
+// encrypt option. The ID of the key is stored with every value, so values
+// encrypted before a key rotation stay readable as long as Key still returns
+// the old key
+type KeyProvider interface {
+	// CurrentKey returns the ID and the key new values are encrypted with
+	CurrentKey(ctx context.Context) (string, []byte, error)
+	// Key returns the key with the given ID
+	Key(ctx context.Context, id string) ([]byte, error)
+}
+
+// WithKeyProvider sets the provider of the keys used for encrypted fields
+func WithKeyProvider(p KeyProvider) Option {
+	return func(o *options) {
+		o.keys = p
+	}
+}
+
+// envelopeVersion is the first byte of every encrypted value. It is followed
+// by the length of the key ID, the key ID, the nonce and the sealed value.
+// The header up to the nonce is authenticated with the value
+const envelopeVersion byte = 1
+
+// encryptValue seals data with the current key of keys
+func encryptValue(ctx context.Context, keys KeyProvider, data string) (string, error) {
+	if keys == nil {
+		return "", fmt.Errorf("no key provider configured for encrypted fields")
+	}
+	id, key, err := keys.CurrentKey(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(id) == 0 || len(id) > 255 {
+		return "", fmt.Errorf("key ID must be between 1 and 255 bytes")
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	header := append([]byte{envelopeVersion, byte(len(id))}, id...)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(append(header, nonce...), nonce, []byte(data), header)
+	return string(sealed), nil
+}
+
+// decryptValue opens an encrypted value with the key it was sealed with
+func decryptValue(ctx context.Context, keys KeyProvider, data string) (string, error) {
+	if keys == nil {
+		return "", fmt.Errorf("no key provider configured for encrypted fields")
+	}
+	if len(data) < 2 || data[0] != envelopeVersion || len(data) < 2+int(data[1]) {
+		return "", fmt.Errorf("value is not encrypted")
+	}
+	header, rest := []byte(data[:2+int(data[1])]), data[2+int(data[1]):]
+	id := string(header[2:])
+
+	key, err := keys.Key(ctx, id)
+	if err != nil {
+		return "", fmt.Errorf("key %q: %w", id, err)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	if len(rest) < aead.NonceSize() {
+		return "", fmt.Errorf("encrypted value is truncated")
+	}
+	nonce, sealed := []byte(rest[:aead.NonceSize()]), []byte(rest[aead.NonceSize():])
+	plain, err := aead.Open(nil, nonce, sealed, header)
+	if err != nil {
+		return "", fmt.Errorf("key %q: %w", id, err)
+	}
+	return string(plain), nil
+}
+
+// newAEAD returns AES-GCM for a 16, 24 or 32 byte key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// FileKeyProvider is a KeyProvider reading keys from a JSON file of the form
+//
+//	{"current": "2024-06", "keys": {"2024-01": "<base64 key>", "2024-06": "<base64 key>"}}
+//
+// The file is read again when its modification time changes, so keys can be
+// rotated by adding a key, making it current and keeping the old ones
+type FileKeyProvider struct {
+	path string
+
+	mu      sync.Mutex
+	current string
+	keys    map[string][]byte
+	mod     time.Time
+}
+
+// NewFileKeyProvider creates a FileKeyProvider for the key file at path,
+// reading it once to report errors early
+func NewFileKeyProvider(path string) (*FileKeyProvider, error) {
+	p := &FileKeyProvider{path: path}
+	if err := p.load(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *FileKeyProvider) CurrentKey(ctx context.Context) (string, []byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.load(); err != nil {
+		return "", nil, err
+	}
+	return p.current, p.keys[p.current], nil
+}
+
+func (p *FileKeyProvider) Key(ctx context.Context, id string) ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.load(); err != nil {
+		return nil, err
+	}
+	key, ok := p.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown key")
+	}
+	return key, nil
+}
+
+// load reads the key file if it changed since it was last read
+func (p *FileKeyProvider) load() error {
+	mod, err := latestModTime(p.path)
+	if err != nil {
+		return err
+	}
+	if p.keys != nil && mod.Equal(p.mod) {
+		return nil
+	}
+
+	b, err := os.ReadFile(p.path)
+	if err != nil {
+		return err
+	}
+	var file struct {
+		Current string            `json:"current"`
+		Keys    map[string]string `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &file); err != nil {
+		return fmt.Errorf("invalid key file %s: %v", p.path, err)
+	}
+
+	keys := map[string][]byte{}
+	for id, encoded := range file.Keys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return fmt.Errorf("invalid key %q in %s: %v", id, p.path, err)
+		}
+		if _, err := newAEAD(key); err != nil {
+			return fmt.Errorf("invalid key %q in %s: %v", id, p.path, err)
+		}
+		keys[id] = key
+	}
+	if _, ok := keys[file.Current]; !ok {
+		return fmt.Errorf("current key %q not found in %s", file.Current, p.path)
+	}
+
+	p.current = file.Current
+	p.keys = keys
+	p.mod = mod
+	return nil
+}
@@ -0,0 +1,234 @@
+package etcdclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+)
+
+// testKeys is a KeyProvider holding its keys in memory
+type testKeys struct {
+	current string
+	keys    map[string][]byte
+}
+
+func (k *testKeys) CurrentKey(ctx context.Context) (string, []byte, error) {
+	return k.current, k.keys[k.current], nil
+}
+
+func (k *testKeys) Key(ctx context.Context, id string) ([]byte, error) {
+	key, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown key")
+	}
+	return key, nil
+}
+
+func newTestKeys() *testKeys {
+	return &testKeys{
+		current: "k1",
+		keys: map[string][]byte{
+			"k1": bytes.Repeat([]byte{1}, 32),
+			"k2": bytes.Repeat([]byte{2}, 16),
+		},
+	}
+}
+
+type TestSecrets struct {
+	Name   *EtcdString   `path:"/path/:var/name"`
+	Secret *EtcdString   `path:"/path/:var/secret,encrypt"`
+	Pin    int           `path:"/path/:var/pin,encrypt"`
+	Tokens []*EtcdString `path:"/path/:var/tokens,encrypt"`
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	keys := newTestKeys()
+
+	first, err := encryptValue(context.Background(), keys, "secret")
+	require.NoError(t, err)
+	second, err := encryptValue(context.Background(), keys, "secret")
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second)
+	assert.NotContains(t, first, "secret")
+	assert.True(t, strings.HasPrefix(first, "\x01\x02k1"))
+
+	plain, err := decryptValue(context.Background(), keys, first)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", plain)
+}
+
+func TestEncryptKeyRotation(t *testing.T) {
+	keys := newTestKeys()
+	old, err := encryptValue(context.Background(), keys, "secret")
+	require.NoError(t, err)
+
+	keys.current = "k2"
+	rotated, err := encryptValue(context.Background(), keys, "secret")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(rotated, "\x01\x02k2"))
+
+	for _, data := range []string{old, rotated} {
+		plain, err := decryptValue(context.Background(), keys, data)
+		require.NoError(t, err)
+		assert.Equal(t, "secret", plain)
+	}
+
+	delete(keys.keys, "k1")
+	_, err = decryptValue(context.Background(), keys, old)
+	assert.Error(t, err)
+}
+
+func TestDecryptErrors(t *testing.T) {
+	keys := newTestKeys()
+	sealed, err := encryptValue(context.Background(), keys, "secret")
+	require.NoError(t, err)
+
+	// Moving the value to another key ID breaks the authenticated header
+	keys.keys["k3"] = keys.keys["k1"]
+	swapped := "\x01\x02k3" + sealed[4:]
+
+	cases := []struct {
+		name string
+		data string
+		keys KeyProvider
+	}{
+		{name: "tampered", data: sealed[:len(sealed)-1] + string(sealed[len(sealed)-1]^1), keys: keys},
+		{name: "swapped_key_id", data: swapped, keys: keys},
+		{name: "truncated", data: sealed[:8], keys: keys},
+		{name: "plain", data: "secret", keys: keys},
+		{name: "empty", keys: keys},
+		{name: "no_provider", data: sealed},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := decryptValue(context.Background(), tc.keys, tc.data)
+			assert.Error(t, err)
+		})
+	}
+
+	_, err = encryptValue(context.Background(), &testKeys{current: "short", keys: map[string][]byte{"short": []byte("key")}}, "secret")
+	assert.Error(t, err)
+}
+
+func TestEncryptedFieldOps(t *testing.T) {
+	keys := newTestKeys()
+	model := TestSecrets{
+		Name:   SetString("name"),
+		Secret: SetString("secret"),
+		Pin:    1234,
+		Tokens: []*EtcdString{SetString("token")},
+	}
+	pathvar := map[string]string{"@": "", "var": "sub"}
+
+	etcdOps, err := createStructSetOps(reflect.ValueOf(model), "TestSecrets", pathvar, false, newSetPlan(context.Background(), &store{keys: keys}))
+	require.NoError(t, err)
+	require.Len(t, etcdOps, 4)
+	assert.Equal(t, "name", string(etcdOps[0].ValueBytes()))
+	for _, op := range etcdOps[1:] {
+		assert.Equal(t, envelopeVersion, op.ValueBytes()[0])
+	}
+
+	dataToGet := TestSecrets{Name: GetString(), Secret: GetString(), Tokens: []*EtcdString{GetString()}}
+	plan := &getPlan{ctx: context.Background(), store: &store{keys: keys}}
+	_, callbacks, err := createStructGetOps(reflect.ValueOf(&dataToGet).Elem(), "TestSecrets", pathvar, false, plan)
+	require.NoError(t, err)
+	require.Len(t, callbacks, 4)
+	for i, op := range etcdOps {
+		require.NoError(t, callbacks[i](rangeResponse(&mvccpb.KeyValue{Key: op.KeyBytes(), Value: op.ValueBytes()})))
+	}
+	assert.Equal(t, model, dataToGet)
+
+	err = callbacks[1](rangeResponse(&mvccpb.KeyValue{Key: []byte("/path/sub/secret"), Value: []byte("secret")}))
+	assert.True(t, errors.Is(err, ErrDecode))
+
+	_, err = createStructSetOps(reflect.ValueOf(model), "TestSecrets", pathvar, false, newSetPlan(context.Background(), &store{}))
+	assert.True(t, errors.Is(err, ErrEncode))
+}
+
+func TestEncryptedHashedElements(t *testing.T) {
+	pathvar := map[string]string{"@": "", "var": "sub"}
+	plan := newSetPlan(context.Background(), &store{keys: newTestKeys()})
+
+	values := struct {
+		Tokens []*EtcdString `path:"/path/:var/tokens,id=hash,encrypt"`
+	}{Tokens: []*EtcdString{SetString("token")}}
+	_, err := createStructSetOps(reflect.ValueOf(values), "TestSecrets", pathvar, false, plan)
+	assert.True(t, errors.Is(err, ErrInvalidModel))
+
+	type secret struct {
+		Value *EtcdString `path:":@/value,encrypt"`
+	}
+	elements := struct {
+		Secrets []secret `path:"/path/:var/secrets,id=hash"`
+	}{Secrets: []secret{{Value: SetString("token")}}}
+	_, err = createStructSetOps(reflect.ValueOf(elements), "TestSecrets", pathvar, false, plan)
+	assert.Error(t, err)
+
+	records := struct {
+		Records []TestRecord `path:"/path/:var/records,encrypt"`
+	}{Records: []TestRecord{{Name: SetString("name")}}}
+	_, err = createStructSetOps(reflect.ValueOf(records), "TestSecrets", pathvar, false, plan)
+	assert.True(t, errors.Is(err, ErrInvalidModel))
+}
+
+func TestFileKeyProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	mod := time.Now().Add(-time.Minute)
+	writeTestFile(t, path, []byte(`{"current": "k1", "keys": {"k1": "AQEBAQEBAQEBAQEBAQEBAQ=="}}`), mod)
+
+	p, err := NewFileKeyProvider(path)
+	require.NoError(t, err)
+	id, key, err := p.CurrentKey(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "k1", id)
+	assert.Equal(t, bytes.Repeat([]byte{1}, 16), key)
+	old, err := encryptValue(context.Background(), p, "secret")
+	require.NoError(t, err)
+
+	mod = mod.Add(time.Second)
+	writeTestFile(t, path, []byte(`{"current": "k2", "keys": {"k1": "AQEBAQEBAQEBAQEBAQEBAQ==", "k2": "AgICAgICAgICAgICAgICAg=="}}`), mod)
+	id, _, err = p.CurrentKey(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "k2", id)
+	plain, err := decryptValue(context.Background(), p, old)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", plain)
+
+	_, err = p.Key(context.Background(), "k3")
+	assert.Error(t, err)
+}
+
+func TestFileKeyProviderErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		file string
+	}{
+		{name: "invalid_json", file: `{"current":`},
+		{name: "missing_current", file: `{"current": "k2", "keys": {"k1": "AQEBAQEBAQEBAQEBAQEBAQ=="}}`},
+		{name: "invalid_base64", file: `{"current": "k1", "keys": {"k1": "not base64"}}`},
+		{name: "invalid_key_size", file: `{"current": "k1", "keys": {"k1": "AQEB"}}`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "keys.json")
+			writeTestFile(t, path, []byte(tc.file), time.Now())
+			_, err := NewFileKeyProvider(path)
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := NewFileKeyProvider(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,71 @@
+package etcdclient
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrInvalidModel is returned when the struct passed to the store cannot
+	// be mapped to etcd keys
+	ErrInvalidModel = errors.New("invalid model")
+	// ErrPathVarMissing is returned when a path tag references a pathvar
+	// that was not provided
+	ErrPathVarMissing = errors.New("pathvar not populated")
+	// ErrDecode is returned when a value read from etcd cannot be decoded
+	// into its field
+	ErrDecode = errors.New("cannot decode etcd value")
+	// ErrEncode is returned when a field cannot be encoded to an etcd value
+	ErrEncode = errors.New("cannot encode value")
+	// ErrTxnFailed is returned when the etcd transaction could not be
+	// performed
+	ErrTxnFailed = errors.New("etcd transaction failed")
+	// ErrOutOfRange is returned when an ordered list operation refers to an
+	// index the list does not have
+	ErrOutOfRange = errors.New("index out of range")
+)
+
+// Error is the error returned by store operations. Kind is one of the
+// package's Err values and can be matched with errors.Is, while the
+// underlying cause is available through errors.Unwrap
+type Error struct {
+	Kind error
+	// Field is the Go field path of the failing field, e.g.
+	// Parent.Child.IntKey, when the error relates to a single field
+	Field string
+	// Key is the resolved etcd key, when known
+	Key string
+	Err error
+}
+
+func (e *Error) Error() string {
+	msg := e.Kind.Error()
+	if e.Field != "" {
+		msg += fmt.Sprintf(" for field %s", e.Field)
+	}
+	if e.Key != "" {
+		msg += fmt.Sprintf(" at key %s", e.Key)
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *Error) Is(target error) bool {
+	return e.Kind == target
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// withField records the field path on err if it is an *Error that does not
+// have one yet
+func withField(err error, field string) error {
+	var e *Error
+	if errors.As(err, &e) && e.Field == "" {
+		e.Field = field
+	}
+	return err
+}
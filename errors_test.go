@@ -0,0 +1,83 @@
+package etcdclient
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+)
+
+// rangeResponse builds the response etcd returns for a get op
+func rangeResponse(kvs ...*mvccpb.KeyValue) *etcdserverpb.ResponseOp {
+	return &etcdserverpb.ResponseOp{
+		Response: &etcdserverpb.ResponseOp_ResponseRange{
+			ResponseRange: &etcdserverpb.RangeResponse{Kvs: kvs, Count: int64(len(kvs))},
+		},
+	}
+}
+
+func TestPathReplaceErrors(t *testing.T) {
+	cases := []struct {
+		name        string
+		path        string
+		pathvar     map[string]string
+		inslice     bool
+		expectedErr error
+	}{
+		{
+			name:        "missing_pathvar",
+			path:        "/path/:var/to/name",
+			pathvar:     map[string]string{},
+			expectedErr: ErrPathVarMissing,
+		},
+		{
+			name:        "parent_in_slice",
+			path:        ":@/name",
+			pathvar:     map[string]string{"@": "/path"},
+			inslice:     true,
+			expectedErr: ErrInvalidModel,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := pathReplace(tc.path, tc.pathvar, tc.inslice)
+			assert.True(t, errors.Is(err, tc.expectedErr))
+		})
+	}
+}
+
+func TestGetOpsErrorFieldPath(t *testing.T) {
+	model := TestModel2Parent{
+		Child: TestModel2Child{
+			IntKey: GetInt(),
+		},
+	}
+
+	_, _, err := createStructGetOps(reflect.ValueOf(&model).Elem(), "TestModel2Parent", map[string]string{"@": ""}, false, nil)
+	require.Error(t, err)
+
+	var e *Error
+	require.True(t, errors.As(err, &e))
+	assert.True(t, errors.Is(err, ErrPathVarMissing))
+	assert.Equal(t, "TestModel2Parent.Name", e.Field)
+
+	_, callbacks, err := createStructGetOps(reflect.ValueOf(&model).Elem(), "TestModel2Parent", map[string]string{"@": "", "var": "sub"}, false, nil)
+	require.NoError(t, err)
+	require.Len(t, callbacks, 1)
+
+	err = callbacks[0](rangeResponse(&mvccpb.KeyValue{
+		Key:   []byte("/path/sub/to/child/int_key"),
+		Value: []byte("forty-two"),
+	}))
+	require.True(t, errors.As(err, &e))
+	assert.True(t, errors.Is(err, ErrDecode))
+	assert.True(t, errors.Is(err, strconv.ErrSyntax))
+	assert.Equal(t, "TestModel2Parent.Child.IntKey", e.Field)
+	assert.Equal(t, "/path/sub/to/child/int_key", e.Key)
+}
@@ -0,0 +1,166 @@
+package etcdclient
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Time formats selected with the format tag option. Any other value is used
+// as a Go time layout, e.g. format=2006-01-02T15:04:05.000Z07:00
+const (
+	// formatRFC3339 is RFC 3339 without fractional seconds
+	formatRFC3339 = "RFC3339"
+	// formatRFC3339Nano is RFC 3339 with nanoseconds. It is the default
+	formatRFC3339Nano = "RFC3339Nano"
+	// formatUnix is the number of seconds since the Unix epoch
+	formatUnix = "unix"
+	// formatUnixMilli is the number of milliseconds since the Unix epoch
+	formatUnixMilli = "unixmilli"
+)
+
+// layoutReference is the time formatted and parsed back to validate layouts
+var layoutReference = time.Date(2006, time.January, 2, 15, 4, 5, 0, time.UTC)
+
+// checkTimeFormat verifies format names a time format or is a layout that
+// holds a year and can be parsed back
+func checkTimeFormat(format string) error {
+	switch format {
+	case formatRFC3339, formatRFC3339Nano, formatUnix, formatUnixMilli:
+		return nil
+	case "":
+		return fmt.Errorf("empty time format")
+	}
+	t, err := time.Parse(format, layoutReference.Format(format))
+	if err != nil {
+		return fmt.Errorf("invalid time layout %q: %v", format, err)
+	}
+	if t.Year() != layoutReference.Year() {
+		return fmt.Errorf("time layout %q holds no year", format)
+	}
+	return nil
+}
+
+// formatTime formats t in format
+func formatTime(t time.Time, format string) string {
+	switch format {
+	case formatRFC3339:
+		return t.Format(time.RFC3339)
+	case formatRFC3339Nano:
+		return t.Format(time.RFC3339Nano)
+	case formatUnix:
+		return strconv.FormatInt(t.Unix(), 10)
+	case formatUnixMilli:
+		return strconv.FormatInt(t.UnixMilli(), 10)
+	}
+	return t.Format(format)
+}
+
+// parseTime parses a time written in format. Values in another format are
+// read as RFC 3339, the format written before the format option existed, so
+// a field's format can change without rewriting it. Unix times are in UTC
+func parseTime(data string, format string) (time.Time, error) {
+	var t time.Time
+	var err error
+	switch format {
+	case formatRFC3339, formatRFC3339Nano:
+		return time.Parse(time.RFC3339Nano, data)
+	case formatUnix, formatUnixMilli:
+		var n int64
+		if n, err = strconv.ParseInt(data, 10, 64); err == nil {
+			if format == formatUnix {
+				return time.Unix(n, 0).UTC(), nil
+			}
+			return time.UnixMilli(n).UTC(), nil
+		}
+	default:
+		if t, err = time.Parse(format, data); err == nil {
+			return t, nil
+		}
+	}
+	if legacy, lerr := time.Parse(time.RFC3339Nano, data); lerr == nil {
+		return legacy, nil
+	}
+	return t, err
+}
+
+var etcdTimeType = reflect.TypeOf(EtcdTime{})
+
+// isTimeField reports whether a field of type t holds times, alone or as the
+// elements of a slice or map
+func isTimeField(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	return t == timeType || t == etcdTimeType || t == reflect.TypeOf(Value[time.Time]{})
+}
+
+// Byte encodings selected with the encoding tag option
+const (
+	// encodingRaw stores the bytes as they are
+	encodingRaw = "raw"
+	// encodingBase64 is padded standard base64
+	encodingBase64 = "base64"
+	// encodingBase64URL is unpadded URL safe base64. It is the default
+	encodingBase64URL = "base64url"
+	// encodingHex is lower case hex
+	encodingHex = "hex"
+)
+
+// checkEncoding verifies encoding names a byte encoding
+func checkEncoding(encoding string) error {
+	switch encoding {
+	case encodingRaw, encodingBase64, encodingBase64URL, encodingHex:
+		return nil
+	}
+	return fmt.Errorf("unknown byte encoding %q", encoding)
+}
+
+// encodeBytes encodes b in encoding
+func encodeBytes(b []byte, encoding string) string {
+	switch encoding {
+	case encodingRaw:
+		return string(b)
+	case encodingBase64:
+		return base64.StdEncoding.EncodeToString(b)
+	case encodingHex:
+		return hex.EncodeToString(b)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeBytes decodes data written in encoding. Base64 is read with or
+// without padding, as other tools write either
+func decodeBytes(data string, encoding string) ([]byte, error) {
+	switch encoding {
+	case encodingRaw:
+		return []byte(data), nil
+	case encodingBase64:
+		return base64.RawStdEncoding.DecodeString(strings.TrimRight(data, "="))
+	case encodingHex:
+		return hex.DecodeString(data)
+	}
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(data, "="))
+}
+
+var etcdBytesType = reflect.TypeOf(EtcdBytes{})
+
+// isBytesField reports whether a field of type t holds byte slices, alone or
+// as the elements of a slice or map
+func isBytesField(t reflect.Type) bool {
+	for {
+		if t == bytesType || t == etcdBytesType || t == reflect.TypeOf(Value[[]byte]{}) {
+			return true
+		}
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Map:
+			t = t.Elem()
+		default:
+			return false
+		}
+	}
+}
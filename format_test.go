@@ -0,0 +1,245 @@
+package etcdclient
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+)
+
+type TestFormats struct {
+	Created  *EtcdTime         `path:"/path/:var/created"`
+	Seen     *EtcdTime         `path:"/path/:var/seen,format=unix"`
+	Updated  time.Time         `path:"/path/:var/updated,format=unixmilli"`
+	Expires  *Value[time.Time] `path:"/path/:var/expires,format=2006-01-02 15:04:05.000 -0700"`
+	Legacy   *EtcdTime         `path:"/path/:var/legacy,format=RFC3339"`
+	Schedule []*EtcdTime       `path:"/path/:var/schedule,format=unix"`
+}
+
+func TestTimeFormats(t *testing.T) {
+	zone := time.FixedZone("", -3*60*60)
+	value := time.Date(2018, 8, 30, 12, 0, 0, 123456789, zone)
+
+	cases := []struct {
+		name     string
+		format   string
+		expected string
+		parsed   time.Time
+	}{
+		{name: "rfc3339", format: formatRFC3339, expected: "2018-08-30T12:00:00-03:00", parsed: value.Truncate(time.Second)},
+		{name: "rfc3339nano", format: formatRFC3339Nano, expected: "2018-08-30T12:00:00.123456789-03:00", parsed: value},
+		{name: "unix", format: formatUnix, expected: "1535641200", parsed: value.Truncate(time.Second)},
+		{name: "unixmilli", format: formatUnixMilli, expected: "1535641200123", parsed: value.Truncate(time.Millisecond)},
+		{name: "layout", format: DateTimeFormat, expected: "2018-08-30T12:00:00-0300", parsed: value.Truncate(time.Second)},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.NoError(t, checkTimeFormat(tc.format))
+			data := formatTime(value, tc.format)
+			assert.Equal(t, tc.expected, data)
+
+			parsed, err := parseTime(data, tc.format)
+			require.NoError(t, err)
+			assert.True(t, tc.parsed.Equal(parsed), "expected %s, got %s", tc.parsed, parsed)
+		})
+	}
+}
+
+func TestTimeFormatLegacyValues(t *testing.T) {
+	cases := []struct {
+		name        string
+		data        string
+		format      string
+		expected    time.Time
+		expectedErr bool
+	}{
+		{name: "rfc3339_as_unix", data: "2018-08-30T12:00:00Z", format: formatUnix, expected: testTime},
+		{name: "rfc3339_as_layout", data: "2018-08-30T12:00:00Z", format: DateTimeFormat, expected: testTime},
+		{name: "fraction_as_rfc3339", data: "2018-08-30T12:00:00.5Z", format: formatRFC3339, expected: testTime.Add(500 * time.Millisecond)},
+		{name: "unknown", data: "yesterday", format: formatUnix, expectedErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			parsed, err := parseTime(tc.data, tc.format)
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, tc.expected.Equal(parsed), "expected %s, got %s", tc.expected, parsed)
+		})
+	}
+}
+
+func TestTimeFormatOps(t *testing.T) {
+	value := time.Date(2018, 8, 30, 12, 0, 0, 123456789, time.UTC)
+	model := TestFormats{
+		Created:  SetTime(value),
+		Seen:     SetTime(value),
+		Updated:  value,
+		Expires:  Set(value),
+		Legacy:   SetTime(value),
+		Schedule: []*EtcdTime{SetTime(value)},
+	}
+	pathvar := map[string]string{"@": "", "var": "sub"}
+
+	etcdOps, err := createStructSetOps(reflect.ValueOf(model), "TestFormats", pathvar, false, newSetPlan(nil, nil))
+	require.NoError(t, err)
+	require.Len(t, etcdOps, 6)
+	values := []string{}
+	for _, op := range etcdOps {
+		values = append(values, string(op.ValueBytes()))
+	}
+	assert.Equal(t, []string{
+		"2018-08-30T12:00:00.123456789Z",
+		"1535630400",
+		"1535630400123",
+		"2018-08-30 12:00:00.123 +0000",
+		"2018-08-30T12:00:00Z",
+		"1535630400",
+	}, values)
+
+	dataToGet := TestFormats{
+		Created:  GetTime(),
+		Seen:     GetTime(),
+		Expires:  Get[time.Time](),
+		Legacy:   GetTime(),
+		Schedule: []*EtcdTime{GetTime()},
+	}
+	_, callbacks, err := createStructGetOps(reflect.ValueOf(&dataToGet).Elem(), "TestFormats", pathvar, false, nil)
+	require.NoError(t, err)
+	require.Len(t, callbacks, 6)
+	require.NoError(t, callbacks[0](rangeResponse(&mvccpb.KeyValue{Key: []byte("/path/sub/created"), Value: []byte("2018-08-30T12:00:00.123456789Z")})))
+	// Written before the field had a format
+	require.NoError(t, callbacks[1](rangeResponse(&mvccpb.KeyValue{Key: []byte("/path/sub/seen"), Value: []byte("2018-08-30T12:00:00Z")})))
+	require.NoError(t, callbacks[2](rangeResponse(&mvccpb.KeyValue{Key: []byte("/path/sub/updated"), Value: []byte("1535630400123")})))
+	require.NoError(t, callbacks[3](rangeResponse(&mvccpb.KeyValue{Key: []byte("/path/sub/expires"), Value: []byte("2018-08-30 12:00:00.123 +0000")})))
+	require.NoError(t, callbacks[4](rangeResponse(&mvccpb.KeyValue{Key: []byte("/path/sub/legacy"), Value: []byte("2018-08-30T12:00:00Z")})))
+	require.NoError(t, callbacks[5](rangeResponse(&mvccpb.KeyValue{Key: []byte("/path/sub/schedule/a"), Value: []byte("1535630400")})))
+
+	assert.True(t, value.Equal(time.Time(*dataToGet.Created)))
+	assert.True(t, testTime.Equal(time.Time(*dataToGet.Seen)))
+	assert.True(t, value.Truncate(time.Millisecond).Equal(dataToGet.Updated))
+	assert.True(t, value.Truncate(time.Millisecond).Equal(dataToGet.Expires.Val()))
+	assert.True(t, testTime.Equal(time.Time(*dataToGet.Legacy)))
+	assert.True(t, testTime.Equal(time.Time(*dataToGet.Schedule[0])))
+
+	err = callbacks[1](rangeResponse(&mvccpb.KeyValue{Key: []byte("/path/sub/seen"), Value: []byte("soon")}))
+	assert.True(t, errors.Is(err, ErrDecode))
+
+	invalid := struct {
+		Name *EtcdString `path:"/path/:var/name,format=unix"`
+	}{Name: SetString("test")}
+	_, err = createStructSetOps(reflect.ValueOf(invalid), "TestFormats", pathvar, false, newSetPlan(nil, nil))
+	assert.True(t, errors.Is(err, ErrInvalidModel))
+}
+
+type TestEncodings struct {
+	Default *EtcdBytes            `path:"/path/:var/default"`
+	Raw     *EtcdBytes            `path:"/path/:var/raw,encoding=raw"`
+	Std     []byte                `path:"/path/:var/std,encoding=base64"`
+	URL     *Value[[]byte]        `path:"/path/:var/url,encoding=base64url"`
+	Hex     []*EtcdBytes          `path:"/path/:var/hex,encoding=hex"`
+	Blobs   map[string]*EtcdBytes `path:"/path/:var/blobs,encoding=raw"`
+}
+
+func TestBytesRoundTrip(t *testing.T) {
+	// Encodes to both - and _ in URL safe base64
+	data := []byte{0xfb, 0xff, 0xbf}
+
+	e := SetBytes(data)
+	assert.Equal(t, "-_-_", e.ToString())
+	decoded := new(EtcdBytes)
+	require.NoError(t, decoded.FromString(e.ToString()))
+	assert.Equal(t, EtcdBytes(data), *decoded)
+}
+
+func TestByteEncodings(t *testing.T) {
+	data := []byte{0xfb, 0xff, 0xbf, 0x00}
+
+	cases := []struct {
+		name     string
+		encoding string
+		expected string
+		inputs   []string
+	}{
+		{name: "raw", encoding: encodingRaw, expected: "\xfb\xff\xbf\x00"},
+		{name: "base64", encoding: encodingBase64, expected: "+/+/AA==", inputs: []string{"+/+/AA"}},
+		{name: "base64url", encoding: encodingBase64URL, expected: "-_-_AA", inputs: []string{"-_-_AA=="}},
+		{name: "hex", encoding: encodingHex, expected: "fbffbf00", inputs: []string{"FBFFBF00"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.NoError(t, checkEncoding(tc.encoding))
+			assert.Equal(t, tc.expected, encodeBytes(data, tc.encoding))
+			for _, input := range append([]string{tc.expected}, tc.inputs...) {
+				decoded, err := decodeBytes(input, tc.encoding)
+				require.NoError(t, err)
+				assert.Equal(t, data, decoded)
+			}
+		})
+	}
+
+	_, err := decodeBytes("-_-_", encodingBase64)
+	assert.Error(t, err)
+	_, err = decodeBytes("xyz", encodingHex)
+	assert.Error(t, err)
+}
+
+func TestByteEncodingOps(t *testing.T) {
+	data := []byte{0xfb, 0xff, 0xbf}
+	model := TestEncodings{
+		Default: SetBytes(data),
+		Raw:     SetBytes(data),
+		Std:     data,
+		URL:     Set(data),
+		Hex:     []*EtcdBytes{SetBytes(data)},
+		Blobs:   map[string]*EtcdBytes{"a": SetBytes(data)},
+	}
+	pathvar := map[string]string{"@": "", "var": "sub"}
+
+	etcdOps, err := createStructSetOps(reflect.ValueOf(model), "TestEncodings", pathvar, false, newSetPlan(nil, nil))
+	require.NoError(t, err)
+	require.Len(t, etcdOps, 6)
+	values := []string{}
+	for _, op := range etcdOps {
+		values = append(values, string(op.ValueBytes()))
+	}
+	assert.Equal(t, []string{"-_-_", "\xfb\xff\xbf", "+/+/", "-_-_", "fbffbf", "\xfb\xff\xbf"}, values)
+
+	dataToGet := TestEncodings{
+		Default: GetBytes(),
+		Raw:     GetBytes(),
+		URL:     Get[[]byte](),
+		Hex:     []*EtcdBytes{GetBytes()},
+		Blobs:   map[string]*EtcdBytes{"a": GetBytes()},
+	}
+	_, callbacks, err := createStructGetOps(reflect.ValueOf(&dataToGet).Elem(), "TestEncodings", pathvar, false, nil)
+	require.NoError(t, err)
+	require.Len(t, callbacks, 6)
+	keys := []string{"/path/sub/default", "/path/sub/raw", "/path/sub/std", "/path/sub/url", "/path/sub/hex/a", "/path/sub/blobs/a"}
+	for i, v := range values {
+		require.NoError(t, callbacks[i](rangeResponse(&mvccpb.KeyValue{Key: []byte(keys[i]), Value: []byte(v)})))
+	}
+	assert.Equal(t, TestEncodings{
+		Default: SetBytes(data),
+		Raw:     SetBytes(data),
+		Std:     data,
+		URL:     Set(data),
+		Hex:     []*EtcdBytes{SetBytes(data)},
+		Blobs:   map[string]*EtcdBytes{"a": SetBytes(data)},
+	}, dataToGet)
+
+	invalid := struct {
+		Name *EtcdString `path:"/path/:var/name,encoding=hex"`
+	}{Name: SetString("test")}
+	_, err = createStructSetOps(reflect.ValueOf(invalid), "TestEncodings", pathvar, false, newSetPlan(nil, nil))
+	assert.True(t, errors.Is(err, ErrInvalidModel))
+}
@@ -0,0 +1,118 @@
+package etcdclient
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+)
+
+// Lease is a lease granted for the ttl tagged fields of a Set call. The keys
+// attached to it are removed by etcd once it expires or is revoked
+type Lease struct {
+	ID  clientv3.LeaseID
+	TTL time.Duration
+
+	store *store
+}
+
+// KeepAlive renews the lease until ctx is done or the store is closed. The
+// returned channel receives every renewal and must be drained
+func (l *Lease) KeepAlive(ctx context.Context) (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+	var ch <-chan *clientv3.LeaseKeepAliveResponse
+	err := l.store.authenticated(ctx, func(ctx context.Context) error {
+		var err error
+		ch, err = l.store.client.KeepAlive(ctx, l.ID)
+		return err
+	})
+	return ch, err
+}
+
+// KeepAliveOnce renews the lease a single time
+func (l *Lease) KeepAliveOnce(ctx context.Context) error {
+	ctx, cancel := l.store.requestContext(ctx)
+	defer cancel()
+
+	return l.store.authenticated(ctx, func(ctx context.Context) error {
+		_, err := l.store.client.KeepAliveOnce(ctx, l.ID)
+		return err
+	})
+}
+
+// Revoke revokes the lease, deleting every key attached to it
+func (l *Lease) Revoke(ctx context.Context) error {
+	ctx, cancel := l.store.requestContext(ctx)
+	defer cancel()
+
+	return l.store.authenticated(ctx, func(ctx context.Context) error {
+		_, err := l.store.client.Revoke(ctx, l.ID)
+		return err
+	})
+}
+
+// leaseSet grants the leases of a single Set call, reusing one lease for all
+// fields that share a TTL
+type leaseSet struct {
+	ctx    context.Context
+	store  *store
+	leases map[time.Duration]*Lease
+}
+
+func newLeaseSet(ctx context.Context, c *store) *leaseSet {
+	return &leaseSet{
+		ctx:    ctx,
+		store:  c,
+		leases: map[time.Duration]*Lease{},
+	}
+}
+
+// grant returns the lease for ttl, granting it on first use
+func (s *leaseSet) grant(ttl time.Duration) (clientv3.LeaseID, error) {
+	if l, ok := s.leases[ttl]; ok {
+		return l.ID, nil
+	}
+
+	// etcd TTLs have a granularity of a second, round up so keys never
+	// expire earlier than requested
+	seconds := int64((ttl + time.Second - 1) / time.Second)
+	var resp *clientv3.LeaseGrantResponse
+	err := s.store.authenticated(s.ctx, func(ctx context.Context) error {
+		var err error
+		resp, err = s.store.client.Grant(ctx, seconds)
+		return err
+	})
+	if err != nil {
+		return clientv3.NoLease, txnError(err)
+	}
+
+	s.leases[ttl] = &Lease{
+		ID:    resp.ID,
+		TTL:   ttl,
+		store: s.store,
+	}
+	return resp.ID, nil
+}
+
+// list returns the granted leases ordered by TTL
+func (s *leaseSet) list() []*Lease {
+	leases := make([]*Lease, 0, len(s.leases))
+	for _, l := range s.leases {
+		leases = append(leases, l)
+	}
+	sort.Slice(leases, func(i, j int) bool {
+		return leases[i].TTL < leases[j].TTL
+	})
+	return leases
+}
+
+// revoke releases the granted leases after a failed Set. It does not use
+// the Set context as that may be the reason the Set failed
+func (s *leaseSet) revoke() {
+	for _, l := range s.leases {
+		if err := l.Revoke(context.Background()); err != nil {
+			s.store.logger.Warn("Error revoking unused lease", zap.Error(err))
+		}
+	}
+}
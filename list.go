@@ -0,0 +1,208 @@
+package etcdclient
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.uber.org/zap"
+)
+
+// sequenceID returns the ID of the element at sequence number n of an ordered
+// list. IDs are zero padded so their lexical order is the list order
+func sequenceID(n uint64) string {
+	return fmt.Sprintf("%020d", n)
+}
+
+// nextSequence returns the sequence number after the last element of the
+// ordered list under prefix
+func (p *setPlan) nextSequence(field string, prefix string) (uint64, error) {
+	kvs, err := p.readPrefix(field, prefix, append(clientv3.WithLastKey(), clientv3.WithKeysOnly())...)
+	if err != nil {
+		return 0, err
+	}
+	if len(kvs) == 0 {
+		return 0, nil
+	}
+	seq, err := strconv.ParseUint(elementID(prefix, kvs[0].Key), 10, 64)
+	if err != nil {
+		return 0, &Error{Kind: ErrDecode, Field: field, Key: string(kvs[0].Key), Err: fmt.Errorf("not an ordered list sequence key")}
+	}
+	return seq + 1, nil
+}
+
+// InsertElement inserts elem at index of the ordered slice field of model,
+// e.g. Steps or Child.Steps, shifting the elements after it. Only the type
+// and tags of model are used. elem must be of the slice's element type
+func (c *store) InsertElement(ctx context.Context, model interface{}, pathvar map[string]string, field string, index int, elem interface{}, opts ...OpOption) error {
+	return c.editList(ctx, model, pathvar, field, elem, opts, insertLayout(index))
+}
+
+// MoveElement moves the element at index from of the ordered slice field of
+// model to index to, shifting the elements in between
+func (c *store) MoveElement(ctx context.Context, model interface{}, pathvar map[string]string, field string, from int, to int, opts ...OpOption) error {
+	return c.editList(ctx, model, pathvar, field, nil, opts, moveLayout(from, to))
+}
+
+// TruncateElements deletes the elements of the ordered slice field of model
+// from index length on
+func (c *store) TruncateElements(ctx context.Context, model interface{}, pathvar map[string]string, field string, length int, opts ...OpOption) error {
+	return c.editList(ctx, model, pathvar, field, nil, opts, truncateLayout(length))
+}
+
+// insertLayout places a new element at index
+func insertLayout(index int) func(n int) ([]int, error) {
+	return func(n int) ([]int, error) {
+		if index < 0 || index > n {
+			return nil, fmt.Errorf("cannot insert at %d into a list of %d", index, n)
+		}
+		order := append(listOrder(0, index), -1)
+		return append(order, listOrder(index, n)...), nil
+	}
+}
+
+// moveLayout moves the element at from to to
+func moveLayout(from int, to int) func(n int) ([]int, error) {
+	return func(n int) ([]int, error) {
+		if from < 0 || from >= n || to < 0 || to >= n {
+			return nil, fmt.Errorf("cannot move %d to %d in a list of %d", from, to, n)
+		}
+		order := append(listOrder(0, from), listOrder(from+1, n)...)
+		return append(order[:to], append([]int{from}, order[to:]...)...), nil
+	}
+}
+
+// truncateLayout keeps the first length elements
+func truncateLayout(length int) func(n int) ([]int, error) {
+	return func(n int) ([]int, error) {
+		if length < 0 {
+			return nil, fmt.Errorf("cannot truncate to %d", length)
+		}
+		if length > n {
+			return listOrder(0, n), nil
+		}
+		return listOrder(0, length), nil
+	}
+}
+
+// listOrder returns the indexes from start up to end
+func listOrder(start int, end int) []int {
+	order := []int{}
+	for i := start; i < end; i++ {
+		order = append(order, i)
+	}
+	return order
+}
+
+// editList rewrites the ordered slice field of model in a single txn. layout
+// returns, for a list of n elements, the current index of the element at
+// each position of the new list, -1 for elem
+func (c *store) editList(ctx context.Context, model interface{}, pathvar map[string]string, field string, elem interface{}, opts []OpOption, layout func(n int) ([]int, error)) error {
+	if err := validateInterface(model); err != nil {
+		err = &Error{Kind: ErrInvalidModel, Err: err}
+		c.logger.Error("Error validating interface", zap.Error(err))
+		return err
+	}
+	modelType := reflect.TypeOf(model).Elem()
+	pathvar["@"] = ""
+
+	sliceType, etcdKey, tagOpts, err := elementField(modelType, field, pathvar)
+	if err != nil {
+		c.logger.Error("Error resolving field", zap.Error(err))
+		return err
+	}
+	fieldName := modelType.Name() + "." + field
+	if !tagOpts.ordered {
+		return &Error{Kind: ErrInvalidModel, Field: fieldName, Err: fmt.Errorf("field is not an ordered list")}
+	}
+	prefix := etcdKey + "/"
+
+	ctx, cancel := c.requestContext(ctx)
+	defer cancel()
+
+	_, err = c.setWithRetries(ctx, newOpOptions(opts...), func(plan *setPlan) ([]clientv3.Op, error) {
+		kvs, err := plan.readPrefix(fieldName, prefix)
+		if err != nil {
+			return nil, withField(err, fieldName)
+		}
+
+		return listOps(plan, fieldName, prefix, kvs, layout, func(elemName string, elemKey string) ([]clientv3.Op, error) {
+			return elementOps(sliceType, elem, elemName, elemKey, pathvar, tagOpts, plan)
+		})
+	})
+	return err
+}
+
+// listOps builds the ops rewriting the ordered list under prefix, whose key
+// values are kvs, to the layout returned by layout. newElem builds the ops of
+// the new element
+func listOps(plan *setPlan, fieldName string, prefix string, kvs []*mvccpb.KeyValue, layout func(n int) ([]int, error), newElem func(elemName string, elemKey string) ([]clientv3.Op, error)) ([]clientv3.Op, error) {
+	ids := []string{}
+	elems := [][]*mvccpb.KeyValue{}
+	err := eachElement(prefix, kvs, func(id string, kvs []*mvccpb.KeyValue) error {
+		ids = append(ids, id)
+		elems = append(elems, kvs)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := layout(len(elems))
+	if err != nil {
+		return nil, &Error{Kind: ErrOutOfRange, Field: fieldName, Err: err}
+	}
+
+	current := map[string]*mvccpb.KeyValue{}
+	for _, kv := range kvs {
+		current[string(kv.Key)] = kv
+	}
+	written := map[string]bool{}
+	etcdOps := []clientv3.Op{}
+
+	for j, i := range order {
+		elemName := fmt.Sprintf("%s[%d]", fieldName, j)
+		elemKey := prefix + sequenceID(uint64(j))
+		if i < 0 {
+			newOps, err := newElem(elemName, elemKey)
+			if err != nil {
+				return nil, err
+			}
+			for _, op := range newOps {
+				written[string(op.KeyBytes())] = true
+			}
+			etcdOps = append(etcdOps, newOps...)
+			continue
+		}
+
+		// Move the keys of the element, keeping their leases. Keys that
+		// already hold the same value are left alone
+		for _, kv := range elems[i] {
+			key := elemKey + strings.TrimPrefix(string(kv.Key), prefix+ids[i])
+			written[key] = true
+			value, err := plan.resign(string(kv.Key), key, kv.Value)
+			if err != nil {
+				return nil, &Error{Kind: ErrDecode, Field: elemName, Key: string(kv.Key), Err: err}
+			}
+			if cur, ok := current[key]; ok && string(cur.Value) == value && cur.Lease == kv.Lease {
+				continue
+			}
+			putOpts := []clientv3.OpOption{}
+			if kv.Lease != 0 {
+				putOpts = append(putOpts, clientv3.WithLease(clientv3.LeaseID(kv.Lease)))
+			}
+			etcdOps = append(etcdOps, plan.record(elemName, clientv3.OpPut(key, value, putOpts...)))
+		}
+	}
+
+	for _, kv := range kvs {
+		if !written[string(kv.Key)] {
+			etcdOps = append(etcdOps, plan.record(fieldName, clientv3.OpDelete(string(kv.Key))))
+		}
+	}
+	return etcdOps, nil
+}
@@ -0,0 +1,143 @@
+package etcdclient
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+)
+
+type TestList struct {
+	Steps   []*TestElement `path:"/path/:var/steps,ordered"`
+	Values  []*EtcdString  `path:"/path/:var/values,ordered"`
+	Records []TestRecord   `path:"/path/:var/records"`
+}
+
+func TestListLayouts(t *testing.T) {
+	cases := []struct {
+		name          string
+		layout        func(n int) ([]int, error)
+		expectedOrder []int
+		expectedErr   bool
+	}{
+		{
+			name:          "insert_front",
+			layout:        insertLayout(0),
+			expectedOrder: []int{-1, 0, 1, 2},
+		},
+		{
+			name:          "insert_end",
+			layout:        insertLayout(3),
+			expectedOrder: []int{0, 1, 2, -1},
+		},
+		{
+			name:        "insert_past_end",
+			layout:      insertLayout(4),
+			expectedErr: true,
+		},
+		{
+			name:          "move_forward",
+			layout:        moveLayout(0, 2),
+			expectedOrder: []int{1, 2, 0},
+		},
+		{
+			name:          "move_back",
+			layout:        moveLayout(2, 0),
+			expectedOrder: []int{2, 0, 1},
+		},
+		{
+			name:        "move_out_of_range",
+			layout:      moveLayout(0, 3),
+			expectedErr: true,
+		},
+		{
+			name:          "truncate",
+			layout:        truncateLayout(1),
+			expectedOrder: []int{0},
+		},
+		{
+			name:          "truncate_longer",
+			layout:        truncateLayout(5),
+			expectedOrder: []int{0, 1, 2},
+		},
+		{
+			name:        "truncate_negative",
+			layout:      truncateLayout(-1),
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			order, err := tc.layout(3)
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedOrder, order)
+		})
+	}
+}
+
+func TestListOps(t *testing.T) {
+	prefix := "/path/sub/steps/"
+	kvs := []*mvccpb.KeyValue{
+		{Key: []byte(prefix + sequenceID(0) + "/name"), Value: []byte("first")},
+		{Key: []byte(prefix + sequenceID(1) + "/name"), Value: []byte("second"), Lease: 7},
+		{Key: []byte(prefix + sequenceID(2) + "/done"), Value: []byte("true")},
+		{Key: []byte(prefix + sequenceID(2) + "/name"), Value: []byte("third")},
+	}
+	newElem := func(elemName string, elemKey string) ([]clientv3.Op, error) {
+		return []clientv3.Op{clientv3.OpPut(elemKey+"/name", "new")}, nil
+	}
+
+	// Inserting at 1 shifts the second and third elements back
+	etcdOps, err := listOps(newSetPlan(nil, nil), "TestList.Steps", prefix, kvs, insertLayout(1), newElem)
+	require.NoError(t, err)
+	puts, deleted := []string{}, []string{}
+	for _, op := range etcdOps {
+		if op.IsPut() {
+			puts = append(puts, string(op.KeyBytes()))
+		} else {
+			deleted = append(deleted, string(op.KeyBytes()))
+		}
+	}
+	assert.Equal(t, []string{
+		prefix + sequenceID(1) + "/name",
+		prefix + sequenceID(2) + "/name",
+		prefix + sequenceID(3) + "/done",
+		prefix + sequenceID(3) + "/name",
+	}, puts)
+	assert.Equal(t, []string{prefix + sequenceID(2) + "/done"}, deleted)
+
+	// Moving the third element to the front deletes the key only it had
+	etcdOps, err = listOps(newSetPlan(nil, nil), "TestList.Steps", prefix, kvs, moveLayout(2, 0), newElem)
+	require.NoError(t, err)
+	deleted = []string{}
+	for _, op := range etcdOps {
+		if op.IsDelete() {
+			deleted = append(deleted, string(op.KeyBytes()))
+		}
+	}
+	assert.Equal(t, []string{prefix + sequenceID(2) + "/done"}, deleted)
+
+	// Truncating only deletes
+	etcdOps, err = listOps(newSetPlan(nil, nil), "TestList.Steps", prefix, kvs, truncateLayout(1), newElem)
+	require.NoError(t, err)
+	require.Len(t, etcdOps, 3)
+	for _, op := range etcdOps {
+		assert.True(t, op.IsDelete())
+	}
+
+	_, err = listOps(newSetPlan(nil, nil), "TestList.Steps", prefix, kvs, moveLayout(0, 3), newElem)
+	assert.True(t, errors.Is(err, ErrOutOfRange))
+}
+
+func TestSequenceIDsSortInOrder(t *testing.T) {
+	assert.Less(t, sequenceID(9), sequenceID(10))
+	assert.Less(t, sequenceID(99), sequenceID(100))
+}
@@ -0,0 +1,225 @@
+package etcdclient
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+)
+
+// checkMapType verifies a map field has string keys and *EtcdValue, struct
+// or struct pointer values
+func checkMapType(t reflect.Type, fieldPath string) error {
+	elem := t.Elem()
+	if t.Key().Kind() == reflect.String {
+		if elem.Kind() == reflect.Ptr && elem.Implements(etcdValueType) {
+			return nil
+		}
+		if elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		if elem.Kind() == reflect.Struct && codecFor(elem) == nil {
+			return nil
+		}
+	}
+	return &Error{Kind: ErrInvalidModel, Field: fieldPath, Err: fmt.Errorf("Map must have string keys and *EtcdValue or struct values")}
+}
+
+// isValueMap reports whether the values of a map type are *EtcdValue
+func isValueMap(t reflect.Type) bool {
+	return t.Elem().Kind() == reflect.Ptr && t.Elem().Implements(etcdValueType)
+}
+
+// sortedMapKeys returns the keys of a map with string keys in order
+func sortedMapKeys(value reflect.Value) []reflect.Value {
+	keys := value.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+	return keys
+}
+
+// mapEntryName returns the Go path of a map entry, e.g. Service.Labels[env]
+func mapEntryName(fieldPath string, key string) string {
+	return fmt.Sprintf("%s[%s]", fieldPath, key)
+}
+
+// createMapGetOps builds a single prefix get for a map field. Each path
+// segment under the prefix becomes a map key. Any entry of the map is the
+// template for the values read; for maps of values it must be a Get sentinel
+func createMapGetOps(value reflect.Value, fieldPath string, etcdKey string, tagOpts tagOptions, pathvar map[string]string, plan *getPlan) ([]clientv3.Op, []func(*etcdserverpb.ResponseOp) error, error) {
+	etcdOps := []clientv3.Op{}
+	callbacks := []func(*etcdserverpb.ResponseOp) error{}
+
+	// With a mask the entries are read into zero values, and the mask
+	// selects their fields
+	mask := plan.fieldMask()
+	if mask == nil && value.Len() < 1 {
+		return etcdOps, callbacks, nil
+	}
+	if err := checkMapType(value.Type(), fieldPath); err != nil {
+		return nil, nil, err
+	}
+	var template reflect.Value
+	if mask != nil {
+		template = newElement(value.Type().Elem())
+	} else {
+		template = value.MapIndex(sortedMapKeys(value)[0])
+	}
+	prefix := etcdKey + "/"
+
+	if isValueMap(value.Type()) {
+		if mask != nil {
+			if selected, _ := mask.match(fieldPath); !selected {
+				return etcdOps, callbacks, nil
+			}
+		} else if template.IsNil() || !template.Interface().(EtcdValue).IsGet() {
+			return etcdOps, callbacks, nil
+		}
+		etcdOps = append(etcdOps, clientv3.OpGet(prefix, clientv3.WithPrefix()))
+		callbacks = append(callbacks, func(resp *etcdserverpb.ResponseOp) error {
+			entries := reflect.MakeMap(value.Type())
+			plan.clearMeta(fieldPath + "[")
+			for _, kv := range resp.GetResponseRange().Kvs {
+				// Keys nested deeper below the prefix are not entries
+				name := strings.TrimPrefix(string(kv.Key), prefix)
+				if name == "" || strings.Contains(name, "/") {
+					continue
+				}
+				entryName := mapEntryName(fieldPath, name)
+
+				val := reflect.New(value.Type().Elem().Elem())
+				data, err := plan.decode(tagOpts, kv)
+				if err == nil {
+					err = val.Interface().(EtcdValue).FromString(data)
+				}
+				if err != nil {
+					return &Error{Kind: ErrDecode, Field: entryName, Key: string(kv.Key), Err: err}
+				}
+				plan.recordMeta(entryName, kv)
+				entries.SetMapIndex(reflect.ValueOf(name).Convert(value.Type().Key()), val)
+			}
+			value.Set(entries)
+			return nil
+		})
+		return etcdOps, callbacks, nil
+	}
+
+	template, isPtr, err := elementTemplate(template, fieldPath, etcdKey, pathvar, plan)
+	if err != nil {
+		return nil, nil, err
+	}
+	pathvar = elementPathvar(pathvar, "")
+
+	etcdOps = append(etcdOps, clientv3.OpGet(prefix, clientv3.WithPrefix()))
+	callbacks = append(callbacks, func(resp *etcdserverpb.ResponseOp) error {
+		entries := reflect.MakeMap(value.Type())
+		plan.clearMeta(fieldPath + "[")
+
+		err := eachElement(prefix, resp.GetResponseRange().Kvs, func(name string, kvs []*mvccpb.KeyValue) error {
+			elem, err := decodeElement(template, mapEntryName(fieldPath, name), elementPathvar(pathvar, prefix+name), kvs, plan)
+			if err != nil {
+				return err
+			}
+			if isPtr {
+				elem = elem.Addr()
+			}
+			entries.SetMapIndex(reflect.ValueOf(name).Convert(value.Type().Key()), elem)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		value.Set(entries)
+		return nil
+	})
+
+	return etcdOps, callbacks, nil
+}
+
+// createMapSetOps builds the ops for every entry of a map field. Entries are
+// stored under their key below the field's prefix. With the prune tag option
+// the keys under the prefix that have no entry in the map are deleted, so an
+// empty map clears the prefix. A nil map is left untouched
+func createMapSetOps(value reflect.Value, fieldPath string, etcdKey string, pathvar map[string]string, tagOpts tagOptions, plan *setPlan) ([]clientv3.Op, error) {
+	etcdOps := []clientv3.Op{}
+
+	if value.IsNil() {
+		return etcdOps, nil
+	}
+	if err := checkMapType(value.Type(), fieldPath); err != nil {
+		return nil, err
+	}
+	valueMap := isValueMap(value.Type())
+	if !valueMap && tagOpts.ttl > 0 {
+		return nil, &Error{Kind: ErrInvalidModel, Field: fieldPath, Err: fmt.Errorf("ttl can only be set on value and slice fields")}
+	}
+	if !valueMap && tagOpts.encrypt {
+		return nil, &Error{Kind: ErrInvalidModel, Field: fieldPath, Err: fmt.Errorf("encrypt can only be set on value fields")}
+	}
+	if !valueMap && tagOpts.compress != "" {
+		return nil, &Error{Kind: ErrInvalidModel, Field: fieldPath, Err: fmt.Errorf("compress can only be set on value fields")}
+	}
+	prefix := etcdKey + "/"
+
+	present := map[string]bool{}
+	for _, k := range sortedMapKeys(value) {
+		name := k.String()
+		entryName := mapEntryName(fieldPath, name)
+		if name == "" || strings.Contains(name, "/") {
+			return nil, &Error{Kind: ErrInvalidModel, Field: entryName, Err: fmt.Errorf("map keys must be a single non-empty path segment")}
+		}
+		present[name] = true
+
+		entry := value.MapIndex(k)
+		if entry.Kind() == reflect.Ptr && entry.IsNil() {
+			continue
+		}
+
+		if valueMap {
+			iface := entry.Interface().(EtcdValue)
+			if iface.IsDelete() {
+				etcdOps = append(etcdOps, plan.record(entryName, clientv3.OpDelete(prefix+name)))
+			} else if iface.IsSet() {
+				op, err := putValue(plan, entryName, prefix+name, iface, tagOpts)
+				if err != nil {
+					return nil, err
+				}
+				etcdOps = append(etcdOps, op)
+			}
+			continue
+		}
+
+		if entry.Kind() == reflect.Ptr {
+			entry = entry.Elem()
+		}
+		elemKey := prefix + name
+		newOps, err := createStructSetOps(entry, entryName, elementPathvar(pathvar, elemKey), false, plan)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkElementOps(newOps, entryName, elemKey); err != nil {
+			return nil, err
+		}
+		etcdOps = append(etcdOps, newOps...)
+	}
+
+	if tagOpts.prune {
+		kvs, err := plan.readPrefix(fieldPath, prefix, clientv3.WithKeysOnly())
+		if err != nil {
+			return nil, withField(err, fieldPath)
+		}
+		for _, kv := range kvs {
+			if !present[elementID(prefix, kv.Key)] {
+				etcdOps = append(etcdOps, plan.record(fieldPath, clientv3.OpDelete(string(kv.Key))))
+			}
+		}
+	}
+
+	return etcdOps, nil
+}
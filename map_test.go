@@ -0,0 +1,123 @@
+package etcdclient
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+)
+
+type TestMaps struct {
+	Labels   map[string]*EtcdString     `path:"/path/:var/labels"`
+	Records  map[string]TestRecord      `path:"/path/:var/records"`
+	Pointers map[string]*TestRecord     `path:"/path/:var/pointers"`
+	Pruned   map[string]*EtcdString     `path:"/path/:var/pruned,prune"`
+	Invalid  map[int]*EtcdString        `path:"/path/:var/invalid"`
+	Strings  map[string]string          `path:"/path/:var/strings"`
+	Unused   map[string]*TestInvalidMap `path:"/path/:var/unused"`
+}
+
+type TestInvalidMap struct {
+	Name *EtcdString `path:"/path/:var/name"`
+}
+
+func TestMapSetOps(t *testing.T) {
+	model := TestMaps{
+		Labels: map[string]*EtcdString{
+			"env":  SetString("prod"),
+			"team": DeleteString(),
+		},
+		Records: map[string]TestRecord{
+			"a": {Name: SetString("first"), Count: SetInt(1)},
+		},
+	}
+
+	plan := newSetPlan(nil, nil)
+	etcdOps, err := createStructSetOps(reflect.ValueOf(model), "TestMaps", map[string]string{"@": "", "var": "sub"}, false, plan)
+	require.NoError(t, err)
+	require.Len(t, etcdOps, 4)
+
+	assert.True(t, etcdOps[0].IsPut())
+	assert.Equal(t, "/path/sub/labels/env", string(etcdOps[0].KeyBytes()))
+	assert.Equal(t, "prod", string(etcdOps[0].ValueBytes()))
+	assert.True(t, etcdOps[1].IsDelete())
+	assert.Equal(t, "/path/sub/labels/team", string(etcdOps[1].KeyBytes()))
+	assert.Equal(t, "/path/sub/records/a/name", string(etcdOps[2].KeyBytes()))
+	assert.Equal(t, "/path/sub/records/a/count", string(etcdOps[3].KeyBytes()))
+	assert.Equal(t, "TestMaps.Records[a].Count", plan.fields["/path/sub/records/a/count"])
+}
+
+func TestMapGetOps(t *testing.T) {
+	model := TestMaps{
+		Labels:   map[string]*EtcdString{"*": GetString()},
+		Records:  map[string]TestRecord{"*": {Name: GetString(), Count: GetInt()}},
+		Pointers: map[string]*TestRecord{"*": {Name: GetString()}},
+	}
+	meta := Metadata{}
+
+	etcdOps, callbacks, err := createStructGetOps(reflect.ValueOf(&model).Elem(), "TestMaps", map[string]string{"@": "", "var": "sub"}, false, &getPlan{meta: meta})
+	require.NoError(t, err)
+	require.Len(t, etcdOps, 3)
+	assert.Equal(t, "/path/sub/labels/", string(etcdOps[0].KeyBytes()))
+
+	require.NoError(t, callbacks[0](rangeResponse(
+		&mvccpb.KeyValue{Key: []byte("/path/sub/labels/env"), Value: []byte("prod"), ModRevision: 4},
+		&mvccpb.KeyValue{Key: []byte("/path/sub/labels/nested/key"), Value: []byte("ignored")},
+	)))
+	require.NoError(t, callbacks[1](rangeResponse(
+		&mvccpb.KeyValue{Key: []byte("/path/sub/records/a/count"), Value: []byte("1")},
+		&mvccpb.KeyValue{Key: []byte("/path/sub/records/a/name"), Value: []byte("first")},
+		&mvccpb.KeyValue{Key: []byte("/path/sub/records/b/name"), Value: []byte("second")},
+	)))
+	require.NoError(t, callbacks[2](rangeResponse(
+		&mvccpb.KeyValue{Key: []byte("/path/sub/pointers/c/name"), Value: []byte("third")},
+	)))
+
+	assert.Equal(t, TestMaps{
+		Labels: map[string]*EtcdString{"env": SetString("prod")},
+		Records: map[string]TestRecord{
+			"a": {Name: SetString("first"), Count: SetInt(1)},
+			"b": {Name: SetString("second")},
+		},
+		Pointers: map[string]*TestRecord{"c": {Name: SetString("third")}},
+	}, model)
+	assert.Equal(t, int64(4), meta["TestMaps.Labels[env]"].ModRevision)
+}
+
+func TestMapErrors(t *testing.T) {
+	cases := []struct {
+		name  string
+		model TestMaps
+	}{
+		{
+			name:  "non_string_keys",
+			model: TestMaps{Invalid: map[int]*EtcdString{1: SetString("one")}},
+		},
+		{
+			name:  "non_etcd_values",
+			model: TestMaps{Strings: map[string]string{"a": "one"}},
+		},
+		{
+			name:  "key_with_slash",
+			model: TestMaps{Labels: map[string]*EtcdString{"a/b": SetString("one")}},
+		},
+		{
+			name:  "empty_key",
+			model: TestMaps{Labels: map[string]*EtcdString{"": SetString("one")}},
+		},
+		{
+			name:  "absolute_entry_paths",
+			model: TestMaps{Unused: map[string]*TestInvalidMap{"a": {Name: SetString("one")}}},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := createStructSetOps(reflect.ValueOf(tc.model), "TestMaps", map[string]string{"@": "", "var": "sub"}, false, newSetPlan(nil, nil))
+			assert.True(t, errors.Is(err, ErrInvalidModel))
+		})
+	}
+}
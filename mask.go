@@ -0,0 +1,100 @@
+package etcdclient
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// fieldMask selects the fields an operation applies to by Go field path
+// relative to the model, e.g. Name or Child.IntKey. Selecting a struct,
+// slice or map field selects everything below it
+type fieldMask struct {
+	paths []string
+}
+
+func newFieldMask(paths []string) *fieldMask {
+	if len(paths) == 0 {
+		return nil
+	}
+	return &fieldMask{paths: paths}
+}
+
+// match reports whether the field at fieldPath, as built by the op builders,
+// is selected and whether fields below it are
+func (m *fieldMask) match(fieldPath string) (bool, bool) {
+	path := maskPath(fieldPath)
+	below := false
+	for _, p := range m.paths {
+		if path == p || strings.HasPrefix(path, p+".") {
+			return true, true
+		}
+		if strings.HasPrefix(p, path+".") {
+			below = true
+		}
+	}
+	return false, below
+}
+
+// check verifies every path of the mask names a tagged field of model
+func (m *fieldMask) check(model reflect.Type) error {
+	if m == nil {
+		return nil
+	}
+	for _, p := range m.paths {
+		t := model
+		for _, name := range strings.Split(p, ".") {
+			t = maskElem(t)
+			if t.Kind() != reflect.Struct {
+				return &Error{Kind: ErrInvalidModel, Field: p, Err: fmt.Errorf("%s has no fields", t)}
+			}
+			sf, ok := t.FieldByName(name)
+			if !ok {
+				return &Error{Kind: ErrInvalidModel, Field: p, Err: fmt.Errorf("no field %s in %s", name, t)}
+			}
+			if _, ok := sf.Tag.Lookup(tagKey); !ok {
+				return &Error{Kind: ErrInvalidModel, Field: p, Err: fmt.Errorf("field %s has no path tag", name)}
+			}
+			t = sf.Type
+		}
+	}
+	return nil
+}
+
+// maskElem returns the type whose fields are below a field of type t in a
+// mask path: the element type of slices, maps and pointers
+func maskElem(t reflect.Type) reflect.Type {
+	for {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Map:
+			t = t.Elem()
+		default:
+			return t
+		}
+	}
+}
+
+// maskPath converts a field path built by the op builders, e.g.
+// Parent.Records[0].Name, to a mask path without the model name and element
+// indexes, e.g. Records.Name
+func maskPath(fieldPath string) string {
+	if i := strings.Index(fieldPath, "."); i >= 0 {
+		fieldPath = fieldPath[i+1:]
+	} else {
+		return ""
+	}
+
+	var b strings.Builder
+	depth := 0
+	for _, r := range fieldPath {
+		switch {
+		case r == '[':
+			depth++
+		case r == ']' && depth > 0:
+			depth--
+		case depth == 0:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,179 @@
+package etcdclient
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+)
+
+type TestMaskedChild struct {
+	Flag  bool `path:":@/flag"`
+	Count int  `path:":@/count"`
+}
+
+type TestMasked struct {
+	Name     string                 `path:"/path/:var/name"`
+	Legacy   *EtcdString            `path:"/path/:var/legacy"`
+	Child    TestMaskedChild        `path:"/path/:var/child"`
+	Records  []TestRecord           `path:"/path/:var/records"`
+	Labels   map[string]*EtcdString `path:"/path/:var/labels"`
+	Untagged string
+}
+
+func TestFieldMaskMatch(t *testing.T) {
+	mask := newFieldMask([]string{"Name", "Child.Count", "Records.Name"})
+
+	cases := []struct {
+		name             string
+		fieldPath        string
+		expectedSelected bool
+		expectedBelow    bool
+	}{
+		{name: "field", fieldPath: "TestMasked.Name", expectedSelected: true, expectedBelow: true},
+		{name: "parent", fieldPath: "TestMasked.Child", expectedBelow: true},
+		{name: "child", fieldPath: "TestMasked.Child.Count", expectedSelected: true, expectedBelow: true},
+		{name: "sibling", fieldPath: "TestMasked.Child.Flag"},
+		{name: "slice", fieldPath: "TestMasked.Records", expectedBelow: true},
+		{name: "element field", fieldPath: "TestMasked.Records[0].Name", expectedSelected: true, expectedBelow: true},
+		{name: "element field by id", fieldPath: "TestMasked.Records[a.b].Name", expectedSelected: true, expectedBelow: true},
+		{name: "other element field", fieldPath: "TestMasked.Records[0].Count"},
+		{name: "unselected", fieldPath: "TestMasked.Labels"},
+		{name: "name prefix", fieldPath: "TestMasked.NameSuffix"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			selected, below := mask.match(tc.fieldPath)
+			assert.Equal(t, tc.expectedSelected, selected)
+			assert.Equal(t, tc.expectedBelow, below)
+		})
+	}
+}
+
+func TestFieldMaskCheck(t *testing.T) {
+	cases := []struct {
+		name        string
+		paths       []string
+		expectedErr bool
+	}{
+		{name: "none"},
+		{name: "fields", paths: []string{"Name", "Legacy", "Labels"}},
+		{name: "nested", paths: []string{"Child", "Child.Count"}},
+		{name: "element field", paths: []string{"Records.Name"}},
+		{name: "missing", paths: []string{"Missing"}, expectedErr: true},
+		{name: "untagged", paths: []string{"Untagged"}, expectedErr: true},
+		{name: "below value", paths: []string{"Name.Sub"}, expectedErr: true},
+		{name: "missing child", paths: []string{"Child.Missing"}, expectedErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := newFieldMask(tc.paths).check(reflect.TypeOf(TestMasked{}))
+			if tc.expectedErr {
+				assert.True(t, errors.Is(err, ErrInvalidModel))
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestFieldMaskGetOps(t *testing.T) {
+	dataToGet := TestMasked{}
+	pathvar := map[string]string{"@": "", "var": "sub"}
+	plan := &getPlan{mask: newFieldMask([]string{"Name", "Legacy", "Child.Count", "Records.Name", "Labels"})}
+
+	etcdOps, callbacks, err := createStructGetOps(reflect.ValueOf(&dataToGet).Elem(), "TestMasked", pathvar, false, plan)
+	require.NoError(t, err)
+	require.Len(t, etcdOps, 5)
+	keys := []string{}
+	for _, op := range etcdOps {
+		keys = append(keys, string(op.KeyBytes()))
+	}
+	assert.Equal(t, []string{"/path/sub/name", "/path/sub/legacy", "/path/sub/child/count", "/path/sub/records/", "/path/sub/labels/"}, keys)
+
+	require.NoError(t, callbacks[0](rangeResponse(&mvccpb.KeyValue{Key: []byte("/path/sub/name"), Value: []byte("test")})))
+	require.NoError(t, callbacks[1](rangeResponse(&mvccpb.KeyValue{Key: []byte("/path/sub/legacy"), Value: []byte("old")})))
+	require.NoError(t, callbacks[2](rangeResponse(&mvccpb.KeyValue{Key: []byte("/path/sub/child/count"), Value: []byte("3")})))
+	require.NoError(t, callbacks[3](rangeResponse(
+		&mvccpb.KeyValue{Key: []byte("/path/sub/records/a/count"), Value: []byte("1")},
+		&mvccpb.KeyValue{Key: []byte("/path/sub/records/a/name"), Value: []byte("first")},
+	)))
+	require.NoError(t, callbacks[4](rangeResponse(&mvccpb.KeyValue{Key: []byte("/path/sub/labels/env"), Value: []byte("prod")})))
+
+	assert.Equal(t, TestMasked{
+		Name:    "test",
+		Legacy:  SetString("old"),
+		Child:   TestMaskedChild{Count: 3},
+		Records: []TestRecord{{Name: SetString("first")}},
+		Labels:  map[string]*EtcdString{"env": SetString("prod")},
+	}, dataToGet)
+}
+
+func TestFieldMaskSetOps(t *testing.T) {
+	model := TestMasked{
+		Name:    "test",
+		Legacy:  SetString("old"),
+		Child:   TestMaskedChild{Flag: true, Count: 3},
+		Records: []TestRecord{{Name: SetString("first"), Count: SetInt(1)}},
+		Labels:  map[string]*EtcdString{"env": SetString("prod")},
+	}
+	pathvar := map[string]string{"@": "", "var": "sub"}
+	plan := newSetPlan(nil, nil)
+	plan.mask = newFieldMask([]string{"Child.Flag", "Records.Name"})
+
+	etcdOps, err := createStructSetOps(reflect.ValueOf(model), "TestMasked", pathvar, false, plan)
+	require.NoError(t, err)
+	require.Len(t, etcdOps, 2)
+	assert.Equal(t, "/path/sub/child/flag", string(etcdOps[0].KeyBytes()))
+	assert.Equal(t, "true", string(etcdOps[0].ValueBytes()))
+	assert.True(t, strings.HasPrefix(string(etcdOps[1].KeyBytes()), "/path/sub/records/"))
+	assert.True(t, strings.HasSuffix(string(etcdOps[1].KeyBytes()), "/name"))
+	assert.Equal(t, "first", string(etcdOps[1].ValueBytes()))
+}
+
+func TestDeleteOps(t *testing.T) {
+	cases := []struct {
+		name         string
+		paths        []string
+		expectedKeys []string
+		expectedErr  bool
+	}{
+		{
+			name: "all fields",
+			expectedKeys: []string{
+				"/path/sub/name", "/path/sub/legacy", "/path/sub/child/flag", "/path/sub/child/count",
+				"/path/sub/records/", "/path/sub/labels/",
+			},
+		},
+		{name: "selected fields", paths: []string{"Name", "Labels"}, expectedKeys: []string{"/path/sub/name", "/path/sub/labels/"}},
+		{name: "struct field", paths: []string{"Child"}, expectedKeys: []string{"/path/sub/child/flag", "/path/sub/child/count"}},
+		{name: "element field", paths: []string{"Records.Name"}, expectedErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			plan := newSetPlan(nil, nil)
+			plan.mask = newFieldMask(tc.paths)
+
+			etcdOps, err := createStructDeleteOps(reflect.TypeOf(TestMasked{}), "TestMasked", map[string]string{"@": "", "var": "sub"}, plan)
+			if tc.expectedErr {
+				assert.True(t, errors.Is(err, ErrInvalidModel))
+				return
+			}
+			require.NoError(t, err)
+
+			keys := []string{}
+			for _, op := range etcdOps {
+				assert.True(t, op.IsDelete())
+				keys = append(keys, string(op.KeyBytes()))
+			}
+			assert.Equal(t, tc.expectedKeys, keys)
+		})
+	}
+}
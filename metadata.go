@@ -0,0 +1,21 @@
+package etcdclient
+
+import (
+	"go.etcd.io/etcd/client/v3"
+)
+
+// KeyMetadata is the etcd metadata of the key a field was read from
+type KeyMetadata struct {
+	Key            string
+	CreateRevision int64
+	ModRevision    int64
+	// Version is the number of modifications since the key was created
+	Version int64
+	// Lease is the lease the key is attached to, clientv3.NoLease if none
+	Lease clientv3.LeaseID
+}
+
+// Metadata maps Go field paths, e.g. Parent.Child.IntKey or Parent.IDs[0],
+// to the metadata of the key the field was read from. Fields whose key does
+// not exist have no entry
+type Metadata map[string]KeyMetadata
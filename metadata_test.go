@@ -0,0 +1,57 @@
+package etcdclient
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+)
+
+func TestGetMetadata(t *testing.T) {
+	model := TestModel3{
+		Name: GetString(),
+		IDs:  []*EtcdUuid{GetUuid()},
+	}
+	meta := Metadata{
+		"TestModel3.IDs[5]": {Key: "/stale"},
+	}
+
+	_, callbacks, err := createStructGetOps(reflect.ValueOf(&model).Elem(), "TestModel3", map[string]string{"@": "", "var": "sub"}, false, &getPlan{meta: meta})
+	require.NoError(t, err)
+	require.Len(t, callbacks, 2)
+
+	require.NoError(t, callbacks[0](rangeResponse(&mvccpb.KeyValue{
+		Key:            []byte("/path/test/sub/to/name"),
+		Value:          []byte("test"),
+		CreateRevision: 2,
+		ModRevision:    5,
+		Version:        3,
+		Lease:          42,
+	})))
+	require.NoError(t, callbacks[1](rangeResponse(&mvccpb.KeyValue{
+		Key:            []byte("/path/test/sub/to/slice/a"),
+		Value:          []byte("00000000-0000-4000-8000-00000000000a"),
+		CreateRevision: 4,
+		ModRevision:    4,
+		Version:        1,
+	})))
+
+	assert.Equal(t, Metadata{
+		"TestModel3.Name": {
+			Key:            "/path/test/sub/to/name",
+			CreateRevision: 2,
+			ModRevision:    5,
+			Version:        3,
+			Lease:          clientv3.LeaseID(42),
+		},
+		"TestModel3.IDs[0]": {
+			Key:            "/path/test/sub/to/slice/a",
+			CreateRevision: 4,
+			ModRevision:    4,
+			Version:        1,
+		},
+	}, meta)
+}
@@ -0,0 +1,167 @@
+package etcdclient
+
+import (
+	"time"
+
+	"go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+)
+
+// Option configures a Store created by New or NewFromClient
+type Option func(*options)
+
+type options struct {
+	config clientv3.Config
+	logger *zap.Logger
+	tls    *TLSConfig
+
+	timeout time.Duration
+
+	tokenSource TokenSource
+
+	keys        KeyProvider
+	signingKeys KeyProvider
+	compression string
+}
+
+// newOptions applies the passed in options on top of the defaults
+func newOptions(opts ...Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.logger == nil {
+		o.logger = zap.NewNop()
+	}
+	return o
+}
+
+// WithEndpoints sets the etcd cluster endpoints the store connects to
+func WithEndpoints(endpoints ...string) Option {
+	return func(o *options) {
+		o.config.Endpoints = endpoints
+	}
+}
+
+// WithDialTimeout sets the timeout for failing to establish a connection
+func WithDialTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.config.DialTimeout = d
+	}
+}
+
+// WithAutoSyncInterval sets the interval at which the endpoints are
+// refreshed with the latest cluster membership. Zero disables auto-sync
+func WithAutoSyncInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.config.AutoSyncInterval = d
+	}
+}
+
+// WithKeepAlive sets the time after which the client pings the server to see
+// if the transport is alive, and how long it waits for a response to that ping
+func WithKeepAlive(interval, timeout time.Duration) Option {
+	return func(o *options) {
+		o.config.DialKeepAliveTime = interval
+		o.config.DialKeepAliveTimeout = timeout
+	}
+}
+
+// WithLogger sets the logger used by the store. Defaults to a no-op logger
+func WithLogger(logger *zap.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithRequestTimeout bounds every store request that is not already bound by
+// an earlier deadline on the caller's context
+func WithRequestTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.timeout = d
+	}
+}
+
+// WithMaxCallSendMsgSize sets the client-side request size limit in bytes
+func WithMaxCallSendMsgSize(n int) Option {
+	return func(o *options) {
+		o.config.MaxCallSendMsgSize = n
+	}
+}
+
+// WithMaxCallRecvMsgSize sets the client-side response size limit in bytes
+func WithMaxCallRecvMsgSize(n int) Option {
+	return func(o *options) {
+		o.config.MaxCallRecvMsgSize = n
+	}
+}
+
+// OpOption configures a single store operation
+type OpOption func(*opOptions)
+
+type opOptions struct {
+	revisions *Revisions
+	metadata  Metadata
+	unchanged *Revisions
+	mode      setMode
+	fields    []string
+}
+
+func newOpOptions(opts ...OpOption) *opOptions {
+	o := &opOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithRevisions records the revisions of the keys read by a Get in revs, to
+// be passed to a later SetIfUnchanged
+func WithRevisions(revs *Revisions) OpOption {
+	return func(o *opOptions) {
+		o.revisions = revs
+	}
+}
+
+// WithMetadata records the etcd metadata of every field decoded by a Get in
+// meta, keyed by Go field path
+func WithMetadata(meta Metadata) OpOption {
+	return func(o *opOptions) {
+		o.metadata = meta
+	}
+}
+
+// IfUnchanged makes a Set fail with a *ConflictError if any of the keys it
+// writes were modified since the Get that recorded revs
+func IfUnchanged(revs *Revisions) OpOption {
+	return func(o *opOptions) {
+		o.unchanged = revs
+	}
+}
+
+// CreateOnly makes a Set fail with a *ConflictError if any of the keys it
+// puts already exist
+func CreateOnly() OpOption {
+	return func(o *opOptions) {
+		o.mode = setCreateOnly
+	}
+}
+
+// UpdateOnly makes a Set fail with a *ConflictError if any of the keys it
+// puts do not exist yet
+func UpdateOnly() OpOption {
+	return func(o *opOptions) {
+		o.mode = setUpdateOnly
+	}
+}
+
+// Fields restricts an operation to the fields at the given Go field paths
+// relative to the model, e.g. Fields("Name", "Child.IntKey"). A Get reads the
+// selected fields whether or not they hold Get sentinels, a Set writes only
+// the selected fields and a Delete deletes them. Selecting a struct, slice
+// or map field selects everything below it
+func Fields(paths ...string) OpOption {
+	return func(o *opOptions) {
+		o.fields = append(o.fields, paths...)
+	}
+}
@@ -0,0 +1,82 @@
+package etcdclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestNewOptions(t *testing.T) {
+	logger := zap.NewExample()
+
+	o := newOptions(
+		WithEndpoints("http://etcd-0:2379", "http://etcd-1:2379"),
+		WithDialTimeout(5*time.Second),
+		WithAutoSyncInterval(time.Minute),
+		WithKeepAlive(10*time.Second, 3*time.Second),
+		WithLogger(logger),
+		WithMaxCallSendMsgSize(1<<20),
+		WithMaxCallRecvMsgSize(4<<20),
+		WithRequestTimeout(2*time.Second),
+	)
+
+	assert.Equal(t, []string{"http://etcd-0:2379", "http://etcd-1:2379"}, o.config.Endpoints)
+	assert.Equal(t, 5*time.Second, o.config.DialTimeout)
+	assert.Equal(t, time.Minute, o.config.AutoSyncInterval)
+	assert.Equal(t, 10*time.Second, o.config.DialKeepAliveTime)
+	assert.Equal(t, 3*time.Second, o.config.DialKeepAliveTimeout)
+	assert.Equal(t, 1<<20, o.config.MaxCallSendMsgSize)
+	assert.Equal(t, 4<<20, o.config.MaxCallRecvMsgSize)
+	assert.Equal(t, 2*time.Second, o.timeout)
+	assert.Equal(t, logger, o.logger)
+}
+
+func TestNewOptionsDefaultLogger(t *testing.T) {
+	o := newOptions()
+	assert.NotNil(t, o.logger)
+}
+
+func TestNewRequiresEndpoints(t *testing.T) {
+	_, err := New()
+	require.Error(t, err)
+}
+
+func TestNewRejectsUnknownCompression(t *testing.T) {
+	_, err := New(WithEndpoints("http://etcd-0:2379"), WithCompression("lz4"))
+	require.Error(t, err)
+}
+
+func TestNewFromClientRequiresClient(t *testing.T) {
+	_, err := NewFromClient(nil)
+	require.Error(t, err)
+}
+
+func TestRequestContext(t *testing.T) {
+	c := &store{timeout: time.Minute}
+
+	ctx, cancel := c.requestContext(context.Background())
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	require.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+
+	// An earlier deadline on the caller's context is kept
+	parent, parentCancel := context.WithTimeout(context.Background(), time.Second)
+	defer parentCancel()
+	ctx, cancel = c.requestContext(parent)
+	defer cancel()
+	deadline, ok = ctx.Deadline()
+	require.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Second), deadline, time.Second)
+
+	// Without a default timeout the caller's context is used as is
+	c = &store{}
+	ctx, cancel = c.requestContext(context.Background())
+	defer cancel()
+	_, ok = ctx.Deadline()
+	assert.False(t, ok)
+}
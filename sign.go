@@ -0,0 +1,85 @@
+package etcdclient
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+)
+
+// IntegrityError is returned when a value read from etcd does not carry a
+// valid signature for the key it is stored at. Get and Watch return it
+// wrapped in an *Error of Kind ErrDecode
+type IntegrityError struct {
+	// Key is the etcd key of the value
+	Key string
+	// KeyID is the ID of the signing key the value claims, when it has one
+	KeyID string
+	Err   error
+}
+
+func (e *IntegrityError) Error() string {
+	return fmt.Sprintf("integrity check failed for key %s: %v", e.Key, e.Err)
+}
+
+func (e *IntegrityError) Unwrap() error {
+	return e.Err
+}
+
+// WithSigningKeys signs every value the store writes with HMAC-SHA256 and a
+// key from p, and verifies the signature of every value it reads. The
+// signature covers the value, the etcd key and the ID of the signing key, so
+// values cannot be changed or copied to other keys without detection
+func WithSigningKeys(p KeyProvider) Option {
+	return func(o *options) {
+		o.signingKeys = p
+	}
+}
+
+// signatureVersion is the first byte of every signed value. It is followed by
+// the length of the key ID, the key ID, the signature and the value
+const signatureVersion byte = 1
+
+// signValue signs data for etcdKey with the current key of keys
+func signValue(ctx context.Context, keys KeyProvider, etcdKey string, data string) (string, error) {
+	id, key, err := keys.CurrentKey(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(id) == 0 || len(id) > 255 {
+		return "", fmt.Errorf("key ID must be between 1 and 255 bytes")
+	}
+	header := append([]byte{signatureVersion, byte(len(id))}, id...)
+	return string(header) + string(signature(key, header, etcdKey, data)) + data, nil
+}
+
+// verifyValue checks the signature of a value read from etcdKey and returns
+// the data that was signed
+func verifyValue(ctx context.Context, keys KeyProvider, etcdKey string, value string) (string, error) {
+	if len(value) < 2 || value[0] != signatureVersion || len(value) < 2+int(value[1])+sha256.Size {
+		return "", &IntegrityError{Key: etcdKey, Err: fmt.Errorf("value is not signed")}
+	}
+	end := 2 + int(value[1])
+	header, id := []byte(value[:end]), value[2:end]
+	mac, data := []byte(value[end:end+sha256.Size]), value[end+sha256.Size:]
+
+	key, err := keys.Key(ctx, id)
+	if err != nil {
+		return "", &IntegrityError{Key: etcdKey, KeyID: id, Err: err}
+	}
+	if !hmac.Equal(mac, signature(key, header, etcdKey, data)) {
+		return "", &IntegrityError{Key: etcdKey, KeyID: id, Err: fmt.Errorf("signature mismatch")}
+	}
+	return data, nil
+}
+
+// signature computes the HMAC of the signed value's header, etcd key and data
+func signature(key []byte, header []byte, etcdKey string, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(header)
+	binary.Write(h, binary.BigEndian, uint32(len(etcdKey)))
+	h.Write([]byte(etcdKey))
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
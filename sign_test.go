@@ -0,0 +1,143 @@
+package etcdclient
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+)
+
+func TestSignRoundTrip(t *testing.T) {
+	keys := newTestKeys()
+
+	signed, err := signValue(context.Background(), keys, "/path/sub/name", "value")
+	require.NoError(t, err)
+	assert.Equal(t, "\x01\x02k1", signed[:4])
+
+	data, err := verifyValue(context.Background(), keys, "/path/sub/name", signed)
+	require.NoError(t, err)
+	assert.Equal(t, "value", data)
+
+	// Values signed before a rotation stay valid while the old key is known
+	keys.current = "k2"
+	rotated, err := signValue(context.Background(), keys, "/path/sub/name", "value")
+	require.NoError(t, err)
+	assert.Equal(t, "\x01\x02k2", rotated[:4])
+	for _, value := range []string{signed, rotated} {
+		data, err := verifyValue(context.Background(), keys, "/path/sub/name", value)
+		require.NoError(t, err)
+		assert.Equal(t, "value", data)
+	}
+}
+
+func TestVerifyErrors(t *testing.T) {
+	keys := newTestKeys()
+	signed, err := signValue(context.Background(), keys, "/path/sub/name", "value")
+	require.NoError(t, err)
+
+	// Claiming another key ID breaks the signed header
+	keys.keys["k3"] = keys.keys["k1"]
+
+	cases := []struct {
+		name          string
+		key           string
+		value         string
+		expectedKeyID string
+	}{
+		{name: "tampered", key: "/path/sub/name", value: signed[:len(signed)-1] + "X", expectedKeyID: "k1"},
+		{name: "other_key", key: "/path/sub/other", value: signed, expectedKeyID: "k1"},
+		{name: "swapped_key_id", key: "/path/sub/name", value: "\x01\x02k3" + signed[4:], expectedKeyID: "k3"},
+		{name: "unknown_key_id", key: "/path/sub/name", value: "\x01\x02k9" + signed[4:], expectedKeyID: "k9"},
+		{name: "unsigned", key: "/path/sub/name", value: "value"},
+		{name: "truncated", key: "/path/sub/name", value: signed[:10]},
+		{name: "empty", key: "/path/sub/name"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := verifyValue(context.Background(), keys, tc.key, tc.value)
+			var integrityErr *IntegrityError
+			require.True(t, errors.As(err, &integrityErr))
+			assert.Equal(t, tc.key, integrityErr.Key)
+			assert.Equal(t, tc.expectedKeyID, integrityErr.KeyID)
+		})
+	}
+}
+
+func TestSignedFieldOps(t *testing.T) {
+	s := &store{keys: newTestKeys(), signingKeys: newTestKeys()}
+	model := TestSecrets{
+		Name:   SetString("name"),
+		Secret: SetString("secret"),
+		Pin:    1234,
+		Tokens: []*EtcdString{SetString("token")},
+	}
+	pathvar := map[string]string{"@": "", "var": "sub"}
+
+	etcdOps, err := createStructSetOps(reflect.ValueOf(model), "TestSecrets", pathvar, false, newSetPlan(context.Background(), s))
+	require.NoError(t, err)
+	require.Len(t, etcdOps, 4)
+	for _, op := range etcdOps {
+		assert.Equal(t, signatureVersion, op.ValueBytes()[0])
+	}
+
+	dataToGet := TestSecrets{Name: GetString(), Secret: GetString(), Tokens: []*EtcdString{GetString()}}
+	plan := &getPlan{ctx: context.Background(), store: s}
+	_, callbacks, err := createStructGetOps(reflect.ValueOf(&dataToGet).Elem(), "TestSecrets", pathvar, false, plan)
+	require.NoError(t, err)
+	require.Len(t, callbacks, 4)
+	for i, op := range etcdOps {
+		require.NoError(t, callbacks[i](rangeResponse(&mvccpb.KeyValue{Key: op.KeyBytes(), Value: op.ValueBytes()})))
+	}
+	assert.Equal(t, model, dataToGet)
+
+	// A signed value copied to another field's key is rejected
+	err = callbacks[0](rangeResponse(&mvccpb.KeyValue{Key: []byte("/path/sub/name"), Value: etcdOps[1].ValueBytes()}))
+	assert.True(t, errors.Is(err, ErrDecode))
+	var integrityErr *IntegrityError
+	require.True(t, errors.As(err, &integrityErr))
+	assert.Equal(t, "/path/sub/name", integrityErr.Key)
+
+	err = callbacks[0](rangeResponse(&mvccpb.KeyValue{Key: []byte("/path/sub/name"), Value: []byte("name")}))
+	assert.True(t, errors.As(err, &integrityErr))
+}
+
+func TestSignedListOps(t *testing.T) {
+	s := &store{signingKeys: newTestKeys()}
+	prefix := "/path/sub/steps/"
+	sign := func(key string, data string) []byte {
+		signed, err := signValue(context.Background(), s.signingKeys, key, data)
+		require.NoError(t, err)
+		return []byte(signed)
+	}
+	kvs := []*mvccpb.KeyValue{
+		{Key: []byte(prefix + sequenceID(0) + "/name"), Value: sign(prefix+sequenceID(0)+"/name", "first")},
+		{Key: []byte(prefix + sequenceID(1) + "/name"), Value: sign(prefix+sequenceID(1)+"/name", "second")},
+	}
+
+	// Elements shifted to a new key are signed for that key
+	etcdOps, err := listOps(newSetPlan(context.Background(), s), "TestList.Steps", prefix, kvs, truncateLayout(1), nil)
+	require.NoError(t, err)
+	require.Len(t, etcdOps, 1)
+	etcdOps, err = listOps(newSetPlan(context.Background(), s), "TestList.Steps", prefix, kvs, moveLayout(1, 0), nil)
+	require.NoError(t, err)
+	for _, op := range etcdOps {
+		require.True(t, op.IsPut())
+		data, err := verifyValue(context.Background(), s.signingKeys, string(op.KeyBytes()), string(op.ValueBytes()))
+		require.NoError(t, err)
+		if string(op.KeyBytes()) == prefix+sequenceID(0)+"/name" {
+			assert.Equal(t, "second", data)
+		} else {
+			assert.Equal(t, "first", data)
+		}
+	}
+
+	// Elements that fail verification are not moved
+	kvs[1].Value = []byte("second")
+	_, err = listOps(newSetPlan(context.Background(), s), "TestList.Steps", prefix, kvs, moveLayout(1, 0), nil)
+	assert.True(t, errors.Is(err, ErrDecode))
+}
@@ -0,0 +1,283 @@
+package etcdclient
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+)
+
+// keyRange is the key range read or written by a single op
+type keyRange struct {
+	start []byte
+	end   []byte
+}
+
+// opRange returns the range of op. Single key ops cover just their key
+func opRange(op clientv3.Op) keyRange {
+	r := keyRange{start: op.KeyBytes(), end: op.RangeBytes()}
+	if len(r.end) == 0 {
+		r.end = append(append([]byte{}, r.start...), 0)
+	}
+	return r
+}
+
+func (r keyRange) contains(key []byte) bool {
+	return bytes.Compare(key, r.start) >= 0 && bytes.Compare(key, r.end) < 0
+}
+
+// isStructSlice reports whether the elements of a slice type are structs or
+// pointers to structs, other than EtcdValues and structs encoded as plain
+// values
+func isStructSlice(t reflect.Type) bool {
+	elem := t.Elem()
+	if elem.Implements(etcdValueType) {
+		return false
+	}
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	return elem.Kind() == reflect.Struct && codecFor(elem) == nil
+}
+
+// elementID returns the ID segment of a key stored under a slice prefix
+func elementID(prefix string, key []byte) string {
+	id := strings.TrimPrefix(string(key), prefix)
+	if i := strings.Index(id, "/"); i >= 0 {
+		id = id[:i]
+	}
+	return id
+}
+
+// elementPathvar copies pathvar with @ set to the key of a slice element, so
+// the element's path tags resolve relative to it
+func elementPathvar(pathvar map[string]string, elemKey string) map[string]string {
+	vars := make(map[string]string, len(pathvar))
+	for k, v := range pathvar {
+		vars[k] = v
+	}
+	vars["@"] = elemKey
+	return vars
+}
+
+// checkElementOps verifies every op built for a slice element stays under the
+// element's key, which is the case when its path tags are relative to :@
+func checkElementOps(etcdOps []clientv3.Op, fieldPath string, elemKey string) error {
+	for _, op := range etcdOps {
+		key := string(op.KeyBytes())
+		if !strings.HasPrefix(key, elemKey+"/") {
+			return &Error{Kind: ErrInvalidModel, Field: fieldPath, Key: key, Err: fmt.Errorf("path tags of slice elements must start with :@")}
+		}
+	}
+	return nil
+}
+
+// createStructSliceGetOps builds a single prefix get for a slice of structs.
+// The first element of value is the template for the elements read; every
+// element found under the prefix is decoded into a copy of it
+func createStructSliceGetOps(value reflect.Value, elem reflect.Value, fieldPath string, etcdKey string, pathvar map[string]string, plan *getPlan) ([]clientv3.Op, []func(*etcdserverpb.ResponseOp) error, error) {
+	template, isPtr, err := elementTemplate(elem, fieldPath, etcdKey, pathvar, plan)
+	if err != nil {
+		return nil, nil, err
+	}
+	pathvar = elementPathvar(pathvar, "")
+	prefix := etcdKey + "/"
+
+	etcdOps := []clientv3.Op{clientv3.OpGet(prefix, clientv3.WithPrefix())}
+	callbacks := []func(*etcdserverpb.ResponseOp) error{func(resp *etcdserverpb.ResponseOp) error {
+		elems := reflect.MakeSlice(value.Type(), 0, 0)
+		plan.clearMeta(fieldPath + "[")
+
+		err := eachElement(prefix, resp.GetResponseRange().Kvs, func(id string, kvs []*mvccpb.KeyValue) error {
+			elem, err := decodeElement(template, fmt.Sprintf("%s[%d]", fieldPath, elems.Len()), elementPathvar(pathvar, prefix+id), kvs, plan)
+			if err != nil {
+				return err
+			}
+			recordElementID(elem, id)
+			if isPtr {
+				elems = reflect.Append(elems, elem.Addr())
+			} else {
+				elems = reflect.Append(elems, elem)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		value.Set(elems)
+		return nil
+	}}
+
+	return etcdOps, callbacks, nil
+}
+
+// elementTemplate returns a copy of the struct an element template holds and
+// whether elements are pointers. The element's get ops are built once to
+// validate its path tags before any response arrives
+func elementTemplate(elem reflect.Value, fieldPath string, etcdKey string, pathvar map[string]string, plan *getPlan) (reflect.Value, bool, error) {
+	isPtr := elem.Kind() == reflect.Ptr
+	if isPtr {
+		if elem.IsNil() {
+			return reflect.Value{}, false, &Error{Kind: ErrInvalidModel, Field: fieldPath, Key: etcdKey, Err: fmt.Errorf("template element cannot be nil")}
+		}
+		elem = elem.Elem()
+	}
+	template := cloneValue(elem)
+
+	probeKey := etcdKey + "/id"
+	probeOps, _, err := createStructGetOps(cloneValue(template), fieldPath, elementPathvar(pathvar, probeKey), false, &getPlan{mask: plan.fieldMask()})
+	if err != nil {
+		return reflect.Value{}, false, err
+	}
+	if err := checkElementOps(probeOps, fieldPath, probeKey); err != nil {
+		return reflect.Value{}, false, err
+	}
+	return template, isPtr, nil
+}
+
+// newElement returns a zero element of type t to use as the template of a
+// Get with a field mask, allocating the struct of pointer elements
+func newElement(t reflect.Type) reflect.Value {
+	if t.Kind() == reflect.Ptr {
+		return reflect.New(t.Elem())
+	}
+	return reflect.New(t).Elem()
+}
+
+// eachElement calls fn with the ID and key values of every element stored
+// under prefix. Keys are sorted, so the keys of an element are contiguous
+func eachElement(prefix string, kvs []*mvccpb.KeyValue, fn func(id string, kvs []*mvccpb.KeyValue) error) error {
+	for start := 0; start < len(kvs); {
+		id := elementID(prefix, kvs[start].Key)
+		end := start + 1
+		for end < len(kvs) && elementID(prefix, kvs[end].Key) == id {
+			end++
+		}
+		if err := fn(id, kvs[start:end]); err != nil {
+			return err
+		}
+		start = end
+	}
+	return nil
+}
+
+// decodeElement decodes the key values of a single slice element into a
+// copy of template
+func decodeElement(template reflect.Value, fieldPath string, pathvar map[string]string, kvs []*mvccpb.KeyValue, plan *getPlan) (reflect.Value, error) {
+	elem := cloneValue(template)
+	elemOps, elemCallbacks, err := createStructGetOps(elem, fieldPath, pathvar, false, plan)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	for i, op := range elemOps {
+		r := opRange(op)
+		matched := []*mvccpb.KeyValue{}
+		for _, kv := range kvs {
+			if r.contains(kv.Key) {
+				matched = append(matched, kv)
+			}
+		}
+		resp := &etcdserverpb.ResponseOp{
+			Response: &etcdserverpb.ResponseOp_ResponseRange{
+				ResponseRange: &etcdserverpb.RangeResponse{Kvs: matched, Count: int64(len(matched))},
+			},
+		}
+		if err := elemCallbacks[i](resp); err != nil {
+			return reflect.Value{}, err
+		}
+	}
+	return elem, nil
+}
+
+// createStructSliceSetOps builds the ops for every element of a slice of
+// structs. Each element is stored under its own ID below the slice key, and
+// its path tags resolve relative to that. Elements that carry an ID keep it,
+// new elements get one from the id or ordered tag options and record it when
+// they can
+func createStructSliceSetOps(value reflect.Value, fieldPath string, etcdKey string, pathvar map[string]string, tagOpts tagOptions, plan *setPlan) ([]clientv3.Op, error) {
+	etcdOps := []clientv3.Op{}
+
+	ids := newIDGenerator(fieldPath, etcdKey, tagOpts, plan)
+	for i := 0; i < value.Len(); i++ {
+		elem := value.Index(i)
+		if elem.Kind() == reflect.Ptr {
+			if elem.IsNil() {
+				continue
+			}
+			elem = elem.Elem()
+		}
+		elemName := fmt.Sprintf("%s[%d]", fieldPath, i)
+
+		// Replacing an ordered list renumbers it from the start
+		id := ""
+		if !tagOpts.ordered || !tagOpts.replace {
+			id = carriedElementID(elem)
+		}
+		if id == "" {
+			var err error
+			id, err = ids.next(func() (string, error) {
+				return structContent(elem, elemName, pathvar, plan)
+			})
+			if err != nil {
+				return nil, withField(err, elemName)
+			}
+			recordElementID(elem, id)
+		}
+		if err := checkElementID(id, elemName); err != nil {
+			return nil, err
+		}
+
+		elemKey := etcdKey + "/" + id
+		newOps, err := createStructSetOps(elem, elemName, elementPathvar(pathvar, elemKey), false, plan)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkElementOps(newOps, elemName, elemKey); err != nil {
+			return nil, err
+		}
+		etcdOps = append(etcdOps, newOps...)
+	}
+
+	return etcdOps, nil
+}
+
+// replaceSliceOps adds to the ops built for a slice field the deletes of every
+// other key under its prefix, so the Set replaces the whole slice atomically.
+// etcd rejects a txn that puts keys inside a range it deletes, so the keys
+// are read first and deleted individually, guarded against changes since
+func replaceSliceOps(etcdOps []clientv3.Op, fieldPath string, etcdKey string, plan *setPlan) ([]clientv3.Op, error) {
+	kvs, err := plan.readPrefix(fieldPath, etcdKey+"/", clientv3.WithKeysOnly())
+	if err != nil {
+		return nil, withField(err, fieldPath)
+	}
+	return append(etcdOps, staleDeletes(etcdOps, kvs, fieldPath, plan)...), nil
+}
+
+// staleDeletes returns the deletes of the keys in kvs that etcdOps do not
+// write or delete
+func staleDeletes(etcdOps []clientv3.Op, kvs []*mvccpb.KeyValue, fieldPath string, plan *setPlan) []clientv3.Op {
+	deletes := []clientv3.Op{}
+	ranges := make([]keyRange, 0, len(etcdOps))
+	for _, op := range etcdOps {
+		ranges = append(ranges, opRange(op))
+	}
+	for _, kv := range kvs {
+		written := false
+		for _, r := range ranges {
+			if r.contains(kv.Key) {
+				written = true
+				break
+			}
+		}
+		if !written {
+			deletes = append(deletes, plan.record(fieldPath, clientv3.OpDelete(string(kv.Key))))
+		}
+	}
+	return deletes
+}
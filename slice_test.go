@@ -0,0 +1,119 @@
+package etcdclient
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+)
+
+type TestRecord struct {
+	Name  *EtcdString `path:":@/name"`
+	Count *EtcdInt    `path:":@/count"`
+}
+
+type TestRecords struct {
+	Records  []TestRecord  `path:"/path/:var/records"`
+	Pointers []*TestRecord `path:"/path/:var/pointers"`
+}
+
+type TestInvalidRecord struct {
+	Name *EtcdString `path:"/path/:var/name"`
+}
+
+type TestInvalidRecords struct {
+	Records []TestInvalidRecord `path:"/path/:var/records"`
+}
+
+func TestStructSliceSetOps(t *testing.T) {
+	model := TestRecords{
+		Records: []TestRecord{
+			{Name: SetString("first"), Count: SetInt(1)},
+			{Name: SetString("second")},
+		},
+	}
+
+	plan := newSetPlan(nil, nil)
+	etcdOps, err := createStructSetOps(reflect.ValueOf(model), "TestRecords", map[string]string{"@": "", "var": "sub"}, false, plan)
+	require.NoError(t, err)
+	require.Len(t, etcdOps, 3)
+
+	// Both fields of the first element share its ID
+	first := strings.TrimSuffix(string(etcdOps[0].KeyBytes()), "/name")
+	assert.True(t, strings.HasPrefix(first, "/path/sub/records/"))
+	assert.Equal(t, first+"/count", string(etcdOps[1].KeyBytes()))
+	assert.NotEqual(t, first+"/name", string(etcdOps[2].KeyBytes()))
+	assert.Equal(t, "TestRecords.Records[1].Name", plan.fields[string(etcdOps[2].KeyBytes())])
+}
+
+func TestStructSliceGetOps(t *testing.T) {
+	model := TestRecords{
+		Records:  []TestRecord{{Name: GetString(), Count: GetInt()}},
+		Pointers: []*TestRecord{{Name: GetString()}},
+	}
+
+	etcdOps, callbacks, err := createStructGetOps(reflect.ValueOf(&model).Elem(), "TestRecords", map[string]string{"@": "", "var": "sub"}, false, nil)
+	require.NoError(t, err)
+	require.Len(t, etcdOps, 2)
+	assert.Equal(t, "/path/sub/records/", string(etcdOps[0].KeyBytes()))
+
+	require.NoError(t, callbacks[0](rangeResponse(
+		&mvccpb.KeyValue{Key: []byte("/path/sub/records/a/count"), Value: []byte("1")},
+		&mvccpb.KeyValue{Key: []byte("/path/sub/records/a/name"), Value: []byte("first")},
+		&mvccpb.KeyValue{Key: []byte("/path/sub/records/b/name"), Value: []byte("second")},
+	)))
+	require.NoError(t, callbacks[1](rangeResponse(
+		&mvccpb.KeyValue{Key: []byte("/path/sub/pointers/c/count"), Value: []byte("3")},
+		&mvccpb.KeyValue{Key: []byte("/path/sub/pointers/c/name"), Value: []byte("third")},
+	)))
+
+	assert.Equal(t, TestRecords{
+		Records: []TestRecord{
+			{Name: SetString("first"), Count: SetInt(1)},
+			{Name: SetString("second")},
+		},
+		Pointers: []*TestRecord{
+			{Name: SetString("third")},
+		},
+	}, model)
+}
+
+func TestStructSliceRequiresRelativePaths(t *testing.T) {
+	model := TestInvalidRecords{
+		Records: []TestInvalidRecord{{Name: SetString("test")}},
+	}
+	pathvar := map[string]string{"@": "", "var": "sub"}
+
+	_, err := createStructSetOps(reflect.ValueOf(model), "TestInvalidRecords", pathvar, false, newSetPlan(nil, nil))
+	assert.True(t, errors.Is(err, ErrInvalidModel))
+
+	model.Records[0].Name = GetString()
+	_, _, err = createStructGetOps(reflect.ValueOf(&model).Elem(), "TestInvalidRecords", pathvar, false, nil)
+	assert.True(t, errors.Is(err, ErrInvalidModel))
+}
+
+func TestStaleDeletes(t *testing.T) {
+	etcdOps := []clientv3.Op{
+		clientv3.OpPut("/path/sub/records/a/name", "first"),
+		clientv3.OpDelete("/path/sub/records/b/", clientv3.WithPrefix()),
+	}
+	kvs := []*mvccpb.KeyValue{
+		{Key: []byte("/path/sub/records/a/count")},
+		{Key: []byte("/path/sub/records/a/name")},
+		{Key: []byte("/path/sub/records/b/name")},
+		{Key: []byte("/path/sub/records/c/name")},
+	}
+
+	deletes := staleDeletes(etcdOps, kvs, "TestRecords.Records", newSetPlan(nil, nil))
+	keys := []string{}
+	for _, op := range deletes {
+		assert.True(t, op.IsDelete())
+		keys = append(keys, string(op.KeyBytes()))
+	}
+	assert.Equal(t, []string{"/path/sub/records/a/count", "/path/sub/records/c/name"}, keys)
+}
@@ -0,0 +1,161 @@
+package etcdclient
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// tagOptions holds the options that follow the path in a path tag, e.g.
+// `path:"/svc/:id/heartbeat,ttl=30s"`
+type tagOptions struct {
+	// ttl attaches the keys written for the field to a lease with this TTL
+	ttl time.Duration
+	// prune deletes the keys under a map field's prefix that have no entry in
+	// the map when it is Set
+	prune bool
+	// id selects how the IDs of new slice elements are generated
+	id string
+	// ordered stores slice elements under sequence numbers so they keep
+	// their order
+	ordered bool
+	// replace makes a Set of a slice field replace all of its elements
+	// instead of adding to them
+	replace bool
+	// binary stores UUIDs in their 16 byte form instead of as text
+	binary bool
+	// format is the time format of time fields, a format name or a layout
+	format string
+	// encoding is the encoding of byte fields
+	encoding string
+	// encrypt encrypts the values written for the field with a key from the
+	// store's KeyProvider
+	encrypt bool
+	// compress is the algorithm the values written for the field are
+	// compressed with, overriding the store's compression
+	compress string
+}
+
+// Slice element ID generators selected with the id tag option
+const (
+	// idUUID stores new elements under a random ID. It is the default
+	idUUID = "uuid"
+	// idHash stores elements under a hash of their content, so saving the
+	// same element again overwrites it
+	idHash = "hash"
+)
+
+// parseTag splits a path tag into the path and its options
+func parseTag(tag string) (string, tagOptions, error) {
+	opts := tagOptions{}
+	parts := strings.Split(tag, ",")
+	for _, part := range parts[1:] {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch name {
+		case "ttl":
+			ttl, err := time.ParseDuration(value)
+			if err != nil {
+				return "", opts, &Error{Kind: ErrInvalidModel, Err: fmt.Errorf("invalid ttl %q: %v", value, err)}
+			}
+			if ttl < time.Second {
+				return "", opts, &Error{Kind: ErrInvalidModel, Err: fmt.Errorf("ttl %s is shorter than one second", ttl)}
+			}
+			opts.ttl = ttl
+		case "prune":
+			if value != "" {
+				return "", opts, &Error{Kind: ErrInvalidModel, Err: fmt.Errorf("prune does not take a value")}
+			}
+			opts.prune = true
+		case "id":
+			if value != idUUID && value != idHash {
+				return "", opts, &Error{Kind: ErrInvalidModel, Err: fmt.Errorf("unknown id generator %q", value)}
+			}
+			opts.id = value
+		case "ordered":
+			if value != "" {
+				return "", opts, &Error{Kind: ErrInvalidModel, Err: fmt.Errorf("ordered does not take a value")}
+			}
+			opts.ordered = true
+		case "replace":
+			if value != "" {
+				return "", opts, &Error{Kind: ErrInvalidModel, Err: fmt.Errorf("replace does not take a value")}
+			}
+			opts.replace = true
+		case "binary":
+			if value != "" {
+				return "", opts, &Error{Kind: ErrInvalidModel, Err: fmt.Errorf("binary does not take a value")}
+			}
+			opts.binary = true
+		case "format":
+			if err := checkTimeFormat(value); err != nil {
+				return "", opts, &Error{Kind: ErrInvalidModel, Err: err}
+			}
+			opts.format = value
+		case "encrypt":
+			if value != "" {
+				return "", opts, &Error{Kind: ErrInvalidModel, Err: fmt.Errorf("encrypt does not take a value")}
+			}
+			opts.encrypt = true
+		case "encoding":
+			if err := checkEncoding(value); err != nil {
+				return "", opts, &Error{Kind: ErrInvalidModel, Err: err}
+			}
+			opts.encoding = value
+		case "compress":
+			if err := checkCompression(value); err != nil {
+				return "", opts, &Error{Kind: ErrInvalidModel, Err: err}
+			}
+			opts.compress = value
+		default:
+			return "", opts, &Error{Kind: ErrInvalidModel, Err: fmt.Errorf("unknown path tag option %q", name)}
+		}
+	}
+	if opts.ordered && opts.id != "" {
+		return "", opts, &Error{Kind: ErrInvalidModel, Err: fmt.Errorf("ordered slices are stored under sequence numbers and cannot set id")}
+	}
+	return parts[0], opts, nil
+}
+
+// encode converts data, as encoded for the field's type, to the form stored
+// for the field's options
+func (o tagOptions) encode(data string) (string, error) {
+	if o.format != "" {
+		t, err := time.Parse(time.RFC3339Nano, data)
+		if err != nil {
+			return "", err
+		}
+		data = formatTime(t, o.format)
+	}
+	if o.encoding != "" {
+		b, err := base64.RawURLEncoding.DecodeString(data)
+		if err != nil {
+			return "", err
+		}
+		data = encodeBytes(b, o.encoding)
+	}
+	if o.binary {
+		return compactUUID(data)
+	}
+	return data, nil
+}
+
+// decode converts data stored for the field's options back to the form
+// decoded by the field's type. 16 byte UUIDs are decoded as they are
+func (o tagOptions) decode(data string) (string, error) {
+	if o.format != "" {
+		t, err := parseTime(data, o.format)
+		if err != nil {
+			return "", err
+		}
+		data = t.Format(time.RFC3339Nano)
+	}
+	if o.encoding != "" {
+		b, err := decodeBytes(data, o.encoding)
+		if err != nil {
+			return "", err
+		}
+		data = base64.RawURLEncoding.EncodeToString(b)
+	}
+	return data, nil
+}
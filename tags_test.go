@@ -0,0 +1,159 @@
+package etcdclient
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTag(t *testing.T) {
+	cases := []struct {
+		name         string
+		tag          string
+		expectedPath string
+		expectedOpts tagOptions
+		expectedErr  error
+	}{
+		{
+			name:         "path_only",
+			tag:          "/path/:var/to/name",
+			expectedPath: "/path/:var/to/name",
+		},
+		{
+			name:         "ttl",
+			tag:          "/svc/:id/heartbeat,ttl=30s",
+			expectedPath: "/svc/:id/heartbeat",
+			expectedOpts: tagOptions{ttl: 30 * time.Second},
+		},
+		{
+			name:        "invalid_ttl",
+			tag:         "/svc/:id/heartbeat,ttl=soon",
+			expectedErr: ErrInvalidModel,
+		},
+		{
+			name:        "sub_second_ttl",
+			tag:         "/svc/:id/heartbeat,ttl=500ms",
+			expectedErr: ErrInvalidModel,
+		},
+		{
+			name:         "prune",
+			tag:          "/svc/:id/labels,prune",
+			expectedPath: "/svc/:id/labels",
+			expectedOpts: tagOptions{prune: true},
+		},
+		{
+			name:        "prune_value",
+			tag:         "/svc/:id/labels,prune=yes",
+			expectedErr: ErrInvalidModel,
+		},
+		{
+			name:         "id",
+			tag:          "/svc/:id/tags,id=hash",
+			expectedPath: "/svc/:id/tags",
+			expectedOpts: tagOptions{id: idHash},
+		},
+		{
+			name:        "unknown_id",
+			tag:         "/svc/:id/tags,id=sequential",
+			expectedErr: ErrInvalidModel,
+		},
+		{
+			name:         "ordered",
+			tag:          "/svc/:id/steps,ordered",
+			expectedPath: "/svc/:id/steps",
+			expectedOpts: tagOptions{ordered: true},
+		},
+		{
+			name:        "ordered_with_id",
+			tag:         "/svc/:id/steps,ordered,id=hash",
+			expectedErr: ErrInvalidModel,
+		},
+		{
+			name:         "ordered_replace",
+			tag:          "/svc/:id/steps,ordered,replace",
+			expectedPath: "/svc/:id/steps",
+			expectedOpts: tagOptions{ordered: true, replace: true},
+		},
+		{
+			name:         "binary",
+			tag:          "/svc/:id/owner,binary",
+			expectedPath: "/svc/:id/owner",
+			expectedOpts: tagOptions{binary: true},
+		},
+		{
+			name:        "binary_value",
+			tag:         "/svc/:id/owner,binary=yes",
+			expectedErr: ErrInvalidModel,
+		},
+		{
+			name:         "format",
+			tag:          "/svc/:id/created,format=unixmilli",
+			expectedPath: "/svc/:id/created",
+			expectedOpts: tagOptions{format: formatUnixMilli},
+		},
+		{
+			name:         "format_layout",
+			tag:          "/svc/:id/created,format=2006-01-02 15:04:05.000 MST",
+			expectedPath: "/svc/:id/created",
+			expectedOpts: tagOptions{format: "2006-01-02 15:04:05.000 MST"},
+		},
+		{
+			name:        "format_invalid_layout",
+			tag:         "/svc/:id/created,format=yesterday",
+			expectedErr: ErrInvalidModel,
+		},
+		{
+			name:         "encoding",
+			tag:          "/svc/:id/blob,encoding=hex",
+			expectedPath: "/svc/:id/blob",
+			expectedOpts: tagOptions{encoding: encodingHex},
+		},
+		{
+			name:        "unknown_encoding",
+			tag:         "/svc/:id/blob,encoding=base32",
+			expectedErr: ErrInvalidModel,
+		},
+		{
+			name:         "encrypt",
+			tag:          "/svc/:id/secret,encrypt",
+			expectedPath: "/svc/:id/secret",
+			expectedOpts: tagOptions{encrypt: true},
+		},
+		{
+			name:        "encrypt_value",
+			tag:         "/svc/:id/secret,encrypt=aes",
+			expectedErr: ErrInvalidModel,
+		},
+		{
+			name:         "compress",
+			tag:          "/svc/:id/config,compress=zstd",
+			expectedPath: "/svc/:id/config",
+			expectedOpts: tagOptions{compress: CompressionZstd},
+		},
+		{
+			name:        "unknown_compression",
+			tag:         "/svc/:id/config,compress=lz4",
+			expectedErr: ErrInvalidModel,
+		},
+		{
+			name:        "unknown_option",
+			tag:         "/svc/:id/heartbeat,forever",
+			expectedErr: ErrInvalidModel,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			path, opts, err := parseTag(tc.tag)
+			if tc.expectedErr != nil {
+				assert.True(t, errors.Is(err, tc.expectedErr))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedPath, path)
+			assert.Equal(t, tc.expectedOpts, opts)
+		})
+	}
+}
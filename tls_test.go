@@ -0,0 +1,199 @@
+package etcdclient
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// newTestCert creates a certificate for name signed by parent, or a self
+// signed CA when parent is nil
+func newTestCert(t *testing.T, name string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{name},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func writeTestFile(t *testing.T, path string, b []byte, mod time.Time) {
+	require.NoError(t, os.WriteFile(path, b, 0600))
+	require.NoError(t, os.Chtimes(path, mod, mod))
+}
+
+func TestTLSConfigValidation(t *testing.T) {
+	ca := newTestCert(t, "ca", nil)
+
+	cases := []struct {
+		name        string
+		conf        TLSConfig
+		expectedErr bool
+	}{
+		{
+			name: "ca_pem_only",
+			conf: TLSConfig{CAPEM: ca.certPEM},
+		},
+		{
+			name:        "ca_file_and_pem",
+			conf:        TLSConfig{CAFile: "ca.pem", CAPEM: ca.certPEM},
+			expectedErr: true,
+		},
+		{
+			name:        "cert_without_key",
+			conf:        TLSConfig{CertFile: "cert.pem"},
+			expectedErr: true,
+		},
+		{
+			name:        "cert_pem_without_key",
+			conf:        TLSConfig{CertPEM: ca.certPEM},
+			expectedErr: true,
+		},
+		{
+			name:        "invalid_ca_pem",
+			conf:        TLSConfig{CAPEM: []byte("not a certificate")},
+			expectedErr: true,
+		},
+		{
+			name:        "missing_ca_file",
+			conf:        TLSConfig{CAFile: filepath.Join(t.TempDir(), "missing.pem")},
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.conf.build()
+			if tc.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestTLSConfigReloadsClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil)
+	first := newTestCert(t, "client-1", ca)
+	second := newTestCert(t, "client-2", ca)
+
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client-key.pem")
+	mod := time.Now().Add(-time.Minute)
+	writeTestFile(t, certFile, first.certPEM, mod)
+	writeTestFile(t, keyFile, first.keyPEM, mod)
+
+	conf, err := (&TLSConfig{CertFile: certFile, KeyFile: keyFile}).build()
+	require.NoError(t, err)
+
+	cert, err := conf.GetClientCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, first.cert.Raw, cert.Certificate[0])
+
+	mod = mod.Add(time.Second)
+	writeTestFile(t, certFile, second.certPEM, mod)
+	writeTestFile(t, keyFile, second.keyPEM, mod)
+
+	cert, err = conf.GetClientCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, second.cert.Raw, cert.Certificate[0])
+}
+
+func TestTLSConfigReloadsCAFile(t *testing.T) {
+	dir := t.TempDir()
+	oldCA := newTestCert(t, "old-ca", nil)
+	newCA := newTestCert(t, "new-ca", nil)
+	server := newTestCert(t, "etcd.internal", newCA)
+
+	caFile := filepath.Join(dir, "ca.pem")
+	mod := time.Now().Add(-time.Minute)
+	writeTestFile(t, caFile, oldCA.certPEM, mod)
+
+	conf, err := (&TLSConfig{CAFile: caFile, ServerName: "etcd.internal"}).build()
+	require.NoError(t, err)
+
+	serverConf := &tls.Config{
+		Certificates: []tls.Certificate{{
+			Certificate: [][]byte{server.cert.Raw},
+			PrivateKey:  server.key,
+		}},
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", serverConf)
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	handshake := func() error {
+		conn, err := net.DialTimeout("tcp", ln.Addr().String(), time.Second)
+		require.NoError(t, err)
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		return tls.Client(conn, conf).Handshake()
+	}
+
+	assert.Error(t, handshake())
+
+	writeTestFile(t, caFile, newCA.certPEM, mod.Add(time.Second))
+	assert.NoError(t, handshake())
+}
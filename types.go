@@ -2,6 +2,13 @@ package etcdclient
 
 import (
 	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net"
+	"net/netip"
+	"net/url"
+	"regexp"
 	"strconv"
 	"time"
 
@@ -23,6 +30,17 @@ type EtcdInt int64
 type EtcdUint uint64
 type EtcdBool bool
 type EtcdBytes []byte
+type EtcdFloat float64
+type EtcdDuration time.Duration
+type EtcdIP net.IP
+type EtcdPrefix netip.Prefix
+type EtcdURL url.URL
+type EtcdJSON json.RawMessage
+
+// EtcdDecimal is an arbitrary precision decimal number
+type EtcdDecimal struct {
+	rat big.Rat
+}
 
 var (
 	getTimeOp    EtcdTime
@@ -46,6 +64,27 @@ var (
 	getBytesOp    EtcdBytes
 	deleteBytesOp EtcdBytes
 
+	getFloatOp    EtcdFloat
+	deleteFloatOp EtcdFloat
+
+	getDurationOp    EtcdDuration
+	deleteDurationOp EtcdDuration
+
+	getDecimalOp    EtcdDecimal
+	deleteDecimalOp EtcdDecimal
+
+	getIPOp    EtcdIP
+	deleteIPOp EtcdIP
+
+	getPrefixOp    EtcdPrefix
+	deletePrefixOp EtcdPrefix
+
+	getURLOp    EtcdURL
+	deleteURLOp EtcdURL
+
+	getJSONOp    EtcdJSON
+	deleteJSONOp EtcdJSON
+
 	getSliceOp    []EtcdValue
 	deleteSliceOp []EtcdValue
 )
@@ -54,10 +93,10 @@ func (e *EtcdTime) ToString() string {
 	if e == nil {
 		return ""
 	}
-	return time.Time(*e).Format(time.RFC3339)
+	return time.Time(*e).Format(time.RFC3339Nano)
 }
 func (e *EtcdTime) FromString(value string) error {
-	t, err := time.Parse(time.RFC3339, value)
+	t, err := time.Parse(time.RFC3339Nano, value)
 	if err != nil {
 		return err
 	}
@@ -81,10 +120,35 @@ func (e *EtcdUuid) ToString() string {
 	return string(*e)
 }
 func (e *EtcdUuid) FromString(value string) error {
-	// Checks should be put in place to verify this is an actual UUID
-	*e = EtcdUuid(value)
+	u, err := parseUUID(value)
+	if err != nil {
+		return err
+	}
+	*e = EtcdUuid(u.String())
 	return nil
 }
+
+// Encode returns the canonical form of the UUID, failing if it is not one
+func (e *EtcdUuid) Encode() (string, error) {
+	u, err := parseUUID(string(*e))
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// UUID returns the UUID held, uuid.Nil for nil values or values that are not
+// a UUID
+func (e *EtcdUuid) UUID() uuid.UUID {
+	if e == nil {
+		return uuid.Nil
+	}
+	u, err := parseUUID(string(*e))
+	if err != nil {
+		return uuid.Nil
+	}
+	return u
+}
 func (e *EtcdUuid) IsGet() bool {
 	return e == &getUUIDOp
 }
@@ -186,7 +250,7 @@ func (e *EtcdBytes) ToString() string {
 	return base64.RawURLEncoding.EncodeToString(b)
 }
 func (e *EtcdBytes) FromString(value string) error {
-	b, err := base64.RawStdEncoding.DecodeString(value)
+	b, err := base64.RawURLEncoding.DecodeString(value)
 	if err != nil {
 		return err
 	}
@@ -203,10 +267,274 @@ func (e *EtcdBytes) IsDelete() bool {
 	return e == &deleteBytesOp
 }
 
+func (e *EtcdFloat) ToString() string {
+	if e == nil {
+		return ""
+	}
+	return strconv.FormatFloat(float64(*e), 'g', -1, 64)
+}
+func (e *EtcdFloat) FromString(value string) error {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return err
+	}
+	*e = EtcdFloat(f)
+	return nil
+}
+func (e *EtcdFloat) IsGet() bool {
+	return e == &getFloatOp
+}
+func (e *EtcdFloat) IsSet() bool {
+	return e != &deleteFloatOp && e != nil
+}
+func (e *EtcdFloat) IsDelete() bool {
+	return e == &deleteFloatOp
+}
+
+func (e *EtcdDuration) ToString() string {
+	if e == nil {
+		return ""
+	}
+	return time.Duration(*e).String()
+}
+func (e *EtcdDuration) FromString(value string) error {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*e = EtcdDuration(d)
+	return nil
+}
+func (e *EtcdDuration) IsGet() bool {
+	return e == &getDurationOp
+}
+func (e *EtcdDuration) IsSet() bool {
+	return e != &deleteDurationOp && e != nil
+}
+func (e *EtcdDuration) IsDelete() bool {
+	return e == &deleteDurationOp
+}
+
+// Rat returns a copy of the decimal's value
+func (e *EtcdDecimal) Rat() *big.Rat {
+	if e == nil {
+		return new(big.Rat)
+	}
+	return new(big.Rat).Set(&e.rat)
+}
+func (e *EtcdDecimal) Encode() (string, error) {
+	return formatDecimal(&e.rat)
+}
+func (e *EtcdDecimal) ToString() string {
+	if e == nil {
+		return ""
+	}
+	s, _ := e.Encode()
+	return s
+}
+func (e *EtcdDecimal) FromString(value string) error {
+	r, err := parseDecimal(value)
+	if err != nil {
+		return err
+	}
+	e.rat.Set(r)
+	return nil
+}
+func (e *EtcdDecimal) IsGet() bool {
+	return e == &getDecimalOp
+}
+func (e *EtcdDecimal) IsSet() bool {
+	return e != &deleteDecimalOp && e != nil
+}
+func (e *EtcdDecimal) IsDelete() bool {
+	return e == &deleteDecimalOp
+}
+
+func (e *EtcdIP) ToString() string {
+	if e == nil {
+		return ""
+	}
+	return net.IP(*e).String()
+}
+func (e *EtcdIP) FromString(value string) error {
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return fmt.Errorf("invalid IP address %q", value)
+	}
+	*e = EtcdIP(ip)
+	return nil
+}
+func (e *EtcdIP) IsGet() bool {
+	return e == &getIPOp
+}
+func (e *EtcdIP) IsSet() bool {
+	return e != &deleteIPOp && e != nil
+}
+func (e *EtcdIP) IsDelete() bool {
+	return e == &deleteIPOp
+}
+
+func (e *EtcdPrefix) ToString() string {
+	if e == nil {
+		return ""
+	}
+	return netip.Prefix(*e).String()
+}
+func (e *EtcdPrefix) FromString(value string) error {
+	p, err := netip.ParsePrefix(value)
+	if err != nil {
+		return err
+	}
+	*e = EtcdPrefix(p)
+	return nil
+}
+func (e *EtcdPrefix) IsGet() bool {
+	return e == &getPrefixOp
+}
+func (e *EtcdPrefix) IsSet() bool {
+	return e != &deletePrefixOp && e != nil
+}
+func (e *EtcdPrefix) IsDelete() bool {
+	return e == &deletePrefixOp
+}
+
+func (e *EtcdURL) ToString() string {
+	if e == nil {
+		return ""
+	}
+	return (*url.URL)(e).String()
+}
+func (e *EtcdURL) FromString(value string) error {
+	u, err := parseURL(value)
+	if err != nil {
+		return err
+	}
+	*e = EtcdURL(*u)
+	return nil
+}
+func (e *EtcdURL) IsGet() bool {
+	return e == &getURLOp
+}
+func (e *EtcdURL) IsSet() bool {
+	return e != &deleteURLOp && e != nil
+}
+func (e *EtcdURL) IsDelete() bool {
+	return e == &deleteURLOp
+}
+
+// Unmarshal decodes the JSON document into v
+func (e *EtcdJSON) Unmarshal(v interface{}) error {
+	return json.Unmarshal([]byte(*e), v)
+}
+func (e *EtcdJSON) Encode() (string, error) {
+	if !json.Valid([]byte(*e)) {
+		return "", fmt.Errorf("invalid JSON document")
+	}
+	return string(*e), nil
+}
+func (e *EtcdJSON) ToString() string {
+	if e == nil {
+		return ""
+	}
+	return string(*e)
+}
+func (e *EtcdJSON) FromString(value string) error {
+	if !json.Valid([]byte(value)) {
+		return fmt.Errorf("invalid JSON document")
+	}
+	*e = EtcdJSON(value)
+	return nil
+}
+func (e *EtcdJSON) IsGet() bool {
+	return e == &getJSONOp
+}
+func (e *EtcdJSON) IsSet() bool {
+	return e != &deleteJSONOp && e != nil
+}
+func (e *EtcdJSON) IsDelete() bool {
+	return e == &deleteJSONOp
+}
+
+// decimalPattern matches the decimal numbers accepted by EtcdDecimal: no
+// exponents, fractions or leading plus sign
+var decimalPattern = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+func parseDecimal(value string) (*big.Rat, error) {
+	if !decimalPattern.MatchString(value) {
+		return nil, fmt.Errorf("invalid decimal %q", value)
+	}
+	r, ok := new(big.Rat).SetString(value)
+	if !ok {
+		return nil, fmt.Errorf("invalid decimal %q", value)
+	}
+	return r, nil
+}
+
+// formatDecimal formats r with exactly the digits it needs. Values without a
+// finite decimal expansion, such as 1/3, cannot be formatted
+func formatDecimal(r *big.Rat) (string, error) {
+	// The expansion is finite when the denominator only has the factors 2
+	// and 5, and needs as many digits as the larger of their powers
+	denom := new(big.Int).Set(r.Denom())
+	digits := 0
+	for _, f := range []int64{2, 5} {
+		factor, n, rem := big.NewInt(f), 0, new(big.Int)
+		for {
+			q, _ := new(big.Int).QuoRem(denom, factor, rem)
+			if rem.Sign() != 0 {
+				break
+			}
+			denom, n = q, n+1
+		}
+		if n > digits {
+			digits = n
+		}
+	}
+	if denom.Cmp(big.NewInt(1)) != 0 {
+		return "", fmt.Errorf("%s has no finite decimal expansion", r.String())
+	}
+	return r.FloatString(digits), nil
+}
+
+// parseUUID parses a UUID in its canonical 36 character form, or in the 16
+// byte form written for fields with the binary tag option
+func parseUUID(value string) (uuid.UUID, error) {
+	switch len(value) {
+	case 16:
+		return uuid.FromBytes([]byte(value))
+	case 36:
+		return uuid.Parse(value)
+	}
+	return uuid.Nil, fmt.Errorf("invalid UUID %q", value)
+}
+
+// compactUUID converts an encoded UUID to the 16 byte form
+func compactUUID(data string) (string, error) {
+	u, err := parseUUID(data)
+	if err != nil {
+		return "", err
+	}
+	return string(u[:]), nil
+}
+
+// parseURL parses an absolute URL
+func parseURL(value string) (*url.URL, error) {
+	u, err := url.Parse(value)
+	if err != nil {
+		return nil, err
+	}
+	if !u.IsAbs() {
+		return nil, fmt.Errorf("URL %q is not absolute", value)
+	}
+	return u, nil
+}
+
 var getOp string = "get"
 var deleteOp string = "delete"
 
-const DateTimeFormat = "2005-01-01T13:03:03-0300"
+// DateTimeFormat is a time layout with a numeric zone without a colon, for
+// use with the format tag option
+const DateTimeFormat = "2006-01-02T15:04:05-0700"
 
 func GetTime() *EtcdTime {
 	return &getTimeOp
@@ -229,6 +557,10 @@ func SetUuid(u string) *EtcdUuid {
 	s := EtcdUuid(u)
 	return &s
 }
+func SetUUID(u uuid.UUID) *EtcdUuid {
+	s := EtcdUuid(u.String())
+	return &s
+}
 
 func GetString() *EtcdString {
 	return &getStringOp
@@ -285,9 +617,92 @@ func SetBytes(b []byte) *EtcdBytes {
 	return &c
 }
 
+func GetFloat() *EtcdFloat {
+	return &getFloatOp
+}
+func DeleteFloat() *EtcdFloat {
+	return &deleteFloatOp
+}
+func SetFloat(f float64) *EtcdFloat {
+	g := EtcdFloat(f)
+	return &g
+}
+
+func GetDuration() *EtcdDuration {
+	return &getDurationOp
+}
+func DeleteDuration() *EtcdDuration {
+	return &deleteDurationOp
+}
+func SetDuration(d time.Duration) *EtcdDuration {
+	e := EtcdDuration(d)
+	return &e
+}
+
+func GetDecimal() *EtcdDecimal {
+	return &getDecimalOp
+}
+func DeleteDecimal() *EtcdDecimal {
+	return &deleteDecimalOp
+}
+func SetDecimal(r *big.Rat) *EtcdDecimal {
+	e := &EtcdDecimal{}
+	e.rat.Set(r)
+	return e
+}
+
+func GetIP() *EtcdIP {
+	return &getIPOp
+}
+func DeleteIP() *EtcdIP {
+	return &deleteIPOp
+}
+func SetIP(ip net.IP) *EtcdIP {
+	e := EtcdIP(ip)
+	return &e
+}
+
+func GetPrefix() *EtcdPrefix {
+	return &getPrefixOp
+}
+func DeletePrefix() *EtcdPrefix {
+	return &deletePrefixOp
+}
+func SetPrefix(p netip.Prefix) *EtcdPrefix {
+	e := EtcdPrefix(p)
+	return &e
+}
+
+func GetURL() *EtcdURL {
+	return &getURLOp
+}
+func DeleteURL() *EtcdURL {
+	return &deleteURLOp
+}
+func SetURL(u *url.URL) *EtcdURL {
+	e := EtcdURL(*u)
+	return &e
+}
+
+func GetJSON() *EtcdJSON {
+	return &getJSONOp
+}
+func DeleteJSON() *EtcdJSON {
+	return &deleteJSONOp
+}
+
+// SetJSON returns an EtcdJSON holding the JSON encoding of v
+func SetJSON(v interface{}) (*EtcdJSON, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	e := EtcdJSON(data)
+	return &e, nil
+}
+
 // GenerateUniqueID will generate a uuid to be
 // used as an ID in the data model
 func GenerateUniqueID() string {
 	return uuid.New().String()
 }
-
@@ -0,0 +1,192 @@
+package etcdclient
+
+import (
+	"errors"
+	"math/big"
+	"net"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+)
+
+func mustJSON(t *testing.T, v interface{}) *EtcdJSON {
+	e, err := SetJSON(v)
+	require.NoError(t, err)
+	return e
+}
+
+func TestValueTypesRoundTrip(t *testing.T) {
+	cases := []struct {
+		name     string
+		value    EtcdValue
+		expected string
+	}{
+		{name: "float", value: SetFloat(0.1), expected: "0.1"},
+		{name: "float_exponent", value: SetFloat(-1.5e300), expected: "-1.5e+300"},
+		{name: "duration", value: SetDuration(90 * time.Minute), expected: "1h30m0s"},
+		{name: "decimal", value: SetDecimal(big.NewRat(-12345, 1000)), expected: "-12.345"},
+		{name: "decimal_integer", value: SetDecimal(big.NewRat(42, 1)), expected: "42"},
+		{name: "ipv4", value: SetIP(net.ParseIP("10.0.0.1")), expected: "10.0.0.1"},
+		{name: "ipv6", value: SetIP(net.ParseIP("2001:db8::1")), expected: "2001:db8::1"},
+		{name: "prefix", value: SetPrefix(netip.MustParsePrefix("10.0.0.0/8")), expected: "10.0.0.0/8"},
+		{name: "url", value: SetURL(&url.URL{Scheme: "https", Host: "example.com:8443", Path: "/a b", RawQuery: "q=1"}), expected: "https://example.com:8443/a%20b?q=1"},
+		{name: "json", value: mustJSON(t, map[string]int{"a": 1}), expected: `{"a":1}`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := encodeEtcdValue(tc.value)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, data)
+			assert.Equal(t, tc.expected, tc.value.ToString())
+
+			decoded := reflect.New(reflect.TypeOf(tc.value).Elem()).Interface().(EtcdValue)
+			require.NoError(t, decoded.FromString(data))
+			assert.Equal(t, tc.expected, decoded.ToString())
+			assert.True(t, decoded.IsSet())
+		})
+	}
+}
+
+func TestValueTypesStrictParsing(t *testing.T) {
+	cases := []struct {
+		name  string
+		value EtcdValue
+		data  string
+	}{
+		{name: "float_garbage", value: new(EtcdFloat), data: "1.5x"},
+		{name: "float_range", value: new(EtcdFloat), data: "1e400"},
+		{name: "duration_unitless", value: new(EtcdDuration), data: "10"},
+		{name: "decimal_fraction", value: new(EtcdDecimal), data: "1/3"},
+		{name: "decimal_exponent", value: new(EtcdDecimal), data: "1e3"},
+		{name: "decimal_plus", value: new(EtcdDecimal), data: "+1"},
+		{name: "decimal_trailing_point", value: new(EtcdDecimal), data: "1."},
+		{name: "ip", value: new(EtcdIP), data: "10.0.0.256"},
+		{name: "ip_zone", value: new(EtcdIP), data: "fe80::1%eth0"},
+		{name: "prefix_without_bits", value: new(EtcdPrefix), data: "10.0.0.0"},
+		{name: "url_relative", value: new(EtcdURL), data: "/path"},
+		{name: "url_invalid", value: new(EtcdURL), data: "http://[::1"},
+		{name: "json", value: new(EtcdJSON), data: `{"a":`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Error(t, tc.value.FromString(tc.data))
+		})
+	}
+}
+
+func TestValueTypesEncodeErrors(t *testing.T) {
+	_, err := encodeEtcdValue(SetDecimal(big.NewRat(1, 3)))
+	assert.Error(t, err)
+
+	invalid := EtcdJSON(`{"a":`)
+	_, err = encodeEtcdValue(&invalid)
+	assert.Error(t, err)
+}
+
+func TestValueTypesAccessors(t *testing.T) {
+	d := SetDecimal(big.NewRat(1, 4))
+	r := d.Rat()
+	r.SetInt64(2)
+	assert.Equal(t, "0.25", d.ToString())
+
+	var v map[string]int
+	require.NoError(t, mustJSON(t, map[string]int{"a": 1}).Unmarshal(&v))
+	assert.Equal(t, map[string]int{"a": 1}, v)
+
+	assert.True(t, GetDecimal().IsGet())
+	assert.True(t, DeleteJSON().IsDelete())
+}
+
+type TestUUIDs struct {
+	ID      *EtcdUuid           `path:"/path/:var/id"`
+	Compact *EtcdUuid           `path:"/path/:var/compact,binary"`
+	Owner   uuid.UUID           `path:"/path/:var/owner,binary"`
+	Members []*Value[uuid.UUID] `path:"/path/:var/members,binary"`
+}
+
+func TestUuidParsing(t *testing.T) {
+	cases := []struct {
+		name        string
+		data        string
+		expected    string
+		expectedErr bool
+	}{
+		{name: "canonical", data: "6ba7b810-9dad-11d1-80b4-00c04fd430c8", expected: "6ba7b810-9dad-11d1-80b4-00c04fd430c8"},
+		{name: "upper_case", data: "6BA7B810-9DAD-11D1-80B4-00C04FD430C8", expected: "6ba7b810-9dad-11d1-80b4-00c04fd430c8"},
+		{name: "binary", data: "\x6b\xa7\xb8\x10\x9d\xad\x11\xd1\x80\xb4\x00\xc0\x4f\xd4\x30\xc8", expected: "6ba7b810-9dad-11d1-80b4-00c04fd430c8"},
+		{name: "no_hyphens", data: "6ba7b8109dad11d180b400c04fd430c8", expectedErr: true},
+		{name: "urn", data: "urn:uuid:6ba7b810-9dad-11d1-80b4-00c04fd430c8", expectedErr: true},
+		{name: "braces", data: "{6ba7b810-9dad-11d1-80b4-00c04fd430c8}", expectedErr: true},
+		{name: "invalid_hex", data: "6ba7b810-9dad-11d1-80b4-00c04fd430cz", expectedErr: true},
+		{name: "empty", expectedErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var e EtcdUuid
+			err := e.FromString(tc.data)
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, e.ToString())
+			assert.Equal(t, uuid.MustParse(tc.expected), e.UUID())
+		})
+	}
+
+	_, err := encodeEtcdValue(SetUuid("not-a-uuid"))
+	assert.Error(t, err)
+	assert.Equal(t, uuid.Nil, SetUuid("not-a-uuid").UUID())
+	id := uuid.New()
+	assert.Equal(t, id, SetUUID(id).UUID())
+}
+
+func TestUuidBinaryOps(t *testing.T) {
+	id := uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	model := TestUUIDs{
+		ID:      SetUUID(id),
+		Compact: SetUUID(id),
+		Owner:   id,
+		Members: []*Value[uuid.UUID]{Set(id)},
+	}
+	pathvar := map[string]string{"@": "", "var": "sub"}
+
+	etcdOps, err := createStructSetOps(reflect.ValueOf(model), "TestUUIDs", pathvar, false, newSetPlan(nil, nil))
+	require.NoError(t, err)
+	require.Len(t, etcdOps, 4)
+	assert.Equal(t, id.String(), string(etcdOps[0].ValueBytes()))
+	for _, op := range etcdOps[1:] {
+		assert.Equal(t, id[:], op.ValueBytes())
+	}
+
+	dataToGet := TestUUIDs{Compact: GetUuid(), Members: []*Value[uuid.UUID]{Get[uuid.UUID]()}}
+	_, callbacks, err := createStructGetOps(reflect.ValueOf(&dataToGet).Elem(), "TestUUIDs", pathvar, false, nil)
+	require.NoError(t, err)
+	require.Len(t, callbacks, 3)
+	require.NoError(t, callbacks[0](rangeResponse(&mvccpb.KeyValue{Key: []byte("/path/sub/compact"), Value: id[:]})))
+	require.NoError(t, callbacks[1](rangeResponse(&mvccpb.KeyValue{Key: []byte("/path/sub/owner"), Value: id[:]})))
+	require.NoError(t, callbacks[2](rangeResponse(&mvccpb.KeyValue{Key: []byte("/path/sub/members/a"), Value: id[:]})))
+	assert.Equal(t, id, dataToGet.Compact.UUID())
+	assert.Equal(t, id, dataToGet.Owner)
+	assert.Equal(t, id, dataToGet.Members[0].Val())
+
+	invalid := TestUUIDs{Compact: SetUuid("not-a-uuid")}
+	_, err = createStructSetOps(reflect.ValueOf(invalid), "TestUUIDs", pathvar, false, newSetPlan(nil, nil))
+	assert.True(t, errors.Is(err, ErrEncode))
+
+	notUUID := struct {
+		Name *EtcdString `path:"/path/:var/name,binary"`
+	}{Name: SetString("test")}
+	_, err = createStructSetOps(reflect.ValueOf(notUUID), "TestUUIDs", pathvar, false, newSetPlan(nil, nil))
+	assert.True(t, errors.Is(err, ErrInvalidModel))
+}
@@ -0,0 +1,132 @@
+package etcdclient
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// valueOp is the operation a Value requests
+type valueOp int
+
+const (
+	// opSet is the zero op so values decoded by Get are set values
+	opSet valueOp = iota
+	opGet
+	opDelete
+)
+
+// Value is an EtcdValue for any type T that has a codec: the built in codecs
+// for ordinary Go types, text marshaling methods or a codec registered with
+// RegisterCodec. Create values with Get, Set and Delete
+type Value[T any] struct {
+	v  T
+	op valueOp
+}
+
+// Get returns a Value requesting the field be read
+func Get[T any]() *Value[T] {
+	return &Value[T]{op: opGet}
+}
+
+// Set returns a Value writing v
+func Set[T any](v T) *Value[T] {
+	return &Value[T]{v: v}
+}
+
+// Delete returns a Value requesting the field's key be deleted
+func Delete[T any]() *Value[T] {
+	return &Value[T]{op: opDelete}
+}
+
+// Val returns the value held, the zero value for nil or sentinel values
+func (e *Value[T]) Val() T {
+	if e == nil || e.op != opSet {
+		var zero T
+		return zero
+	}
+	return e.v
+}
+
+// Encode returns the etcd value for the value held
+func (e *Value[T]) Encode() (string, error) {
+	codec, err := valueCodec[T]()
+	if err != nil {
+		return "", err
+	}
+	return codec.Encode(e.v)
+}
+
+func (e *Value[T]) ToString() string {
+	if e == nil {
+		return ""
+	}
+	s, _ := e.Encode()
+	return s
+}
+
+func (e *Value[T]) FromString(value string) error {
+	codec, err := valueCodec[T]()
+	if err != nil {
+		return err
+	}
+	var v T
+	if err := codec.Decode(value, &v); err != nil {
+		return err
+	}
+	e.v, e.op = v, opSet
+	return nil
+}
+
+func (e *Value[T]) IsGet() bool {
+	return e != nil && e.op == opGet
+}
+
+func (e *Value[T]) IsSet() bool {
+	return e != nil && e.op == opSet
+}
+
+func (e *Value[T]) IsDelete() bool {
+	return e != nil && e.op == opDelete
+}
+
+// valueCodec returns the codec for T
+func valueCodec[T any]() (Codec, error) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	codec := codecFor(t)
+	if codec == nil {
+		return nil, fmt.Errorf("no codec registered for %s", t)
+	}
+	return codec, nil
+}
+
+// RegisterTypedCodec registers encode and decode as the codec used for
+// values of type T
+func RegisterTypedCodec[T any](encode func(T) (string, error), decode func(string) (T, error)) {
+	RegisterCodec(reflect.TypeOf((*T)(nil)).Elem(), CodecFuncs{
+		EncodeFunc: func(v interface{}) (string, error) {
+			return encode(v.(T))
+		},
+		DecodeFunc: func(data string, v interface{}) error {
+			decoded, err := decode(data)
+			if err != nil {
+				return err
+			}
+			*v.(*T) = decoded
+			return nil
+		},
+	})
+}
+
+// valueEncoder is implemented by EtcdValues whose encoding can fail
+type valueEncoder interface {
+	Encode() (string, error)
+}
+
+// encodeEtcdValue returns the etcd value of v, reporting encoding failures of
+// the values that can have them
+func encodeEtcdValue(v EtcdValue) (string, error) {
+	if e, ok := v.(valueEncoder); ok {
+		return e.Encode()
+	}
+	return v.ToString(), nil
+}
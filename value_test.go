@@ -0,0 +1,125 @@
+package etcdclient
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+)
+
+type TestPoint struct {
+	X, Y int
+}
+
+type TestValues struct {
+	Name   *Value[string]    `path:"/path/:var/name"`
+	Ratio  *Value[float64]   `path:"/path/:var/ratio"`
+	Point  *Value[TestPoint] `path:"/path/:var/point"`
+	Labels []*Value[string]  `path:"/path/:var/labels"`
+}
+
+type TestUnregistered struct {
+	A int
+}
+
+func init() {
+	RegisterTypedCodec(func(p TestPoint) (string, error) {
+		return strings.Join([]string{SetInt(p.X).ToString(), SetInt(p.Y).ToString()}, ","), nil
+	}, func(data string) (TestPoint, error) {
+		x, y, _ := strings.Cut(data, ",")
+		var px, py EtcdInt
+		if err := px.FromString(x); err != nil {
+			return TestPoint{}, err
+		}
+		if err := py.FromString(y); err != nil {
+			return TestPoint{}, err
+		}
+		return TestPoint{X: int(px), Y: int(py)}, nil
+	})
+}
+
+func TestValueSentinels(t *testing.T) {
+	cases := []struct {
+		name           string
+		value          *Value[string]
+		expectedGet    bool
+		expectedSet    bool
+		expectedDelete bool
+	}{
+		{name: "get", value: Get[string](), expectedGet: true},
+		{name: "set", value: Set("test"), expectedSet: true},
+		{name: "delete", value: Delete[string](), expectedDelete: true},
+		{name: "nil"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedGet, tc.value.IsGet())
+			assert.Equal(t, tc.expectedSet, tc.value.IsSet())
+			assert.Equal(t, tc.expectedDelete, tc.value.IsDelete())
+		})
+	}
+
+	assert.Equal(t, "test", Set("test").Val())
+	assert.Equal(t, "", Get[string]().Val())
+}
+
+func TestValueOps(t *testing.T) {
+	model := TestValues{
+		Name:   Set("test"),
+		Ratio:  Delete[float64](),
+		Point:  Set(TestPoint{X: 1, Y: -2}),
+		Labels: []*Value[string]{Set("a")},
+	}
+	pathvar := map[string]string{"@": "", "var": "sub"}
+
+	etcdOps, err := createStructSetOps(reflect.ValueOf(model), "TestValues", pathvar, false, newSetPlan(nil, nil))
+	require.NoError(t, err)
+	require.Len(t, etcdOps, 4)
+	assert.Equal(t, "test", string(etcdOps[0].ValueBytes()))
+	assert.True(t, etcdOps[1].IsDelete())
+	assert.Equal(t, "1,-2", string(etcdOps[2].ValueBytes()))
+	assert.Equal(t, "a", string(etcdOps[3].ValueBytes()))
+
+	dataToGet := TestValues{
+		Name:   Get[string](),
+		Ratio:  Get[float64](),
+		Point:  Get[TestPoint](),
+		Labels: []*Value[string]{Get[string]()},
+	}
+	_, callbacks, err := createStructGetOps(reflect.ValueOf(&dataToGet).Elem(), "TestValues", pathvar, false, nil)
+	require.NoError(t, err)
+	require.NoError(t, callbacks[0](rangeResponse(&mvccpb.KeyValue{Key: []byte("/path/sub/name"), Value: []byte("test")})))
+	require.NoError(t, callbacks[1](rangeResponse(&mvccpb.KeyValue{Key: []byte("/path/sub/ratio"), Value: []byte("0.5")})))
+	require.NoError(t, callbacks[2](rangeResponse(&mvccpb.KeyValue{Key: []byte("/path/sub/point"), Value: []byte("3,4")})))
+	require.NoError(t, callbacks[3](rangeResponse(
+		&mvccpb.KeyValue{Key: []byte("/path/sub/labels/a"), Value: []byte("x")},
+		&mvccpb.KeyValue{Key: []byte("/path/sub/labels/b"), Value: []byte("y")},
+	)))
+
+	assert.Equal(t, TestValues{
+		Name:   Set("test"),
+		Ratio:  Set(0.5),
+		Point:  Set(TestPoint{X: 3, Y: 4}),
+		Labels: []*Value[string]{Set("x"), Set("y")},
+	}, dataToGet)
+
+	err = callbacks[1](rangeResponse(&mvccpb.KeyValue{Key: []byte("/path/sub/ratio"), Value: []byte("half")}))
+	assert.True(t, errors.Is(err, ErrDecode))
+}
+
+func TestValueWithoutCodec(t *testing.T) {
+	model := struct {
+		Value *Value[TestUnregistered] `path:"/path/:var/value"`
+	}{
+		Value: Set(TestUnregistered{A: 1}),
+	}
+
+	_, err := createStructSetOps(reflect.ValueOf(model), "TestValues", map[string]string{"@": "", "var": "sub"}, false, newSetPlan(nil, nil))
+	assert.True(t, errors.Is(err, ErrEncode))
+	assert.Error(t, Get[TestUnregistered]().FromString("{}"))
+}
@@ -0,0 +1,318 @@
+package etcdclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.uber.org/zap"
+)
+
+// WatchEvent is delivered by Watch whenever the watched fields change
+type WatchEvent struct {
+	// Model is a pointer to a new copy of the watched struct populated with
+	// the values as of Revision
+	Model interface{}
+	// Changed lists the Go field paths of the fields that differ from the
+	// previous event, e.g. Parent.Child.IntKey
+	Changed []string
+	// Revision is the etcd revision the snapshot reflects
+	Revision int64
+	// Err is set when the watch failed. It is the last event on the channel
+	Err error
+}
+
+// Watch watches the fields of model requested with the Get sentinels. The
+// first event holds the current values, and a new snapshot is delivered
+// after every etcd revision that changes one of the fields. The channel is
+// closed when ctx is done or the watch fails
+func (c *store) Watch(ctx context.Context, model interface{}, pathvar map[string]string) (<-chan WatchEvent, error) {
+	value := reflect.ValueOf(model)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		err := &Error{Kind: ErrInvalidModel, Err: fmt.Errorf("Provided interface is not a pointer to a struct")}
+		c.logger.Error("Error validating interface", zap.Error(err))
+		return nil, err
+	}
+
+	w, etcdOps, err := newWatcher(ctx, c, value.Elem(), pathvar)
+	if err != nil {
+		c.logger.Error("Error generating ops", zap.Error(err))
+		return nil, err
+	}
+
+	initial, err := w.load(ctx, etcdOps)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan WatchEvent)
+	go w.run(ctx, initial, events)
+	return events, nil
+}
+
+// watcher maintains the key values of a watched model
+type watcher struct {
+	store    *store
+	plan     *getPlan
+	template reflect.Value
+	pathvar  map[string]string
+	ranges   []keyRange
+	// kvs holds the current key values of each range, sorted by key
+	kvs [][]*mvccpb.KeyValue
+}
+
+// newWatcher creates a watcher for a copy of model and derives the key
+// ranges to watch from the get ops built for it
+func newWatcher(ctx context.Context, c *store, model reflect.Value, pathvar map[string]string) (*watcher, []clientv3.Op, error) {
+	w := &watcher{
+		store:    c,
+		plan:     &getPlan{ctx: ctx, store: c},
+		template: cloneValue(model),
+		pathvar:  map[string]string{},
+	}
+	for k, v := range pathvar {
+		w.pathvar[k] = v
+	}
+	w.pathvar["@"] = ""
+
+	etcdOps, _, err := w.ops()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(etcdOps) == 0 {
+		return nil, nil, &Error{Kind: ErrInvalidModel, Err: fmt.Errorf("model has no fields to watch")}
+	}
+	for _, op := range etcdOps {
+		w.ranges = append(w.ranges, opRange(op))
+	}
+	return w, etcdOps, nil
+}
+
+// ops builds the get ops and callbacks for a fresh copy of the template
+func (w *watcher) ops() ([]clientv3.Op, []func(*etcdserverpb.ResponseOp) error, error) {
+	model := cloneValue(w.template)
+	return createStructGetOps(model, model.Type().Name(), w.pathvar, false, w.plan)
+}
+
+// load reads the current values of the watched ranges and returns the
+// initial event
+func (w *watcher) load(ctx context.Context, etcdOps []clientv3.Op) (WatchEvent, error) {
+	rctx, cancel := w.store.requestContext(ctx)
+	defer cancel()
+
+	var resp *clientv3.TxnResponse
+	err := w.store.authenticated(rctx, func(ctx context.Context) error {
+		var err error
+		resp, err = w.store.client.Txn(ctx).If().Then(etcdOps...).Commit()
+		return err
+	})
+	if err != nil {
+		w.store.logger.Error("Error performing ops", zap.Error(err))
+		return WatchEvent{}, txnError(err)
+	}
+	if len(resp.Responses) != len(w.ranges) {
+		return WatchEvent{}, &Error{Kind: ErrTxnFailed, Err: fmt.Errorf("Unexpected number of responses")}
+	}
+
+	w.kvs = make([][]*mvccpb.KeyValue, len(w.ranges))
+	for i, r := range resp.Responses {
+		w.kvs[i] = r.GetResponseRange().Kvs
+	}
+
+	model, err := w.snapshot()
+	if err != nil {
+		return WatchEvent{}, err
+	}
+	return WatchEvent{
+		Model:    model.Addr().Interface(),
+		Changed:  changedFields(reflect.Value{}, model, model.Type().Name()),
+		Revision: resp.Header.Revision,
+	}, nil
+}
+
+func (w *watcher) run(ctx context.Context, initial WatchEvent, events chan<- WatchEvent) {
+	defer close(events)
+
+	send := func(ev WatchEvent) bool {
+		select {
+		case events <- ev:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	if !send(initial) {
+		return
+	}
+	prev := reflect.ValueOf(initial.Model).Elem()
+
+	wctx, err := w.store.authContext(ctx, false)
+	if err != nil {
+		send(WatchEvent{Err: &AuthError{Err: err}})
+		return
+	}
+
+	// A single watch over a range covering every field delivers all the
+	// changes of a revision together, so no partial snapshot is produced
+	start, end := w.ranges[0].start, w.ranges[0].end
+	for _, r := range w.ranges[1:] {
+		if bytes.Compare(r.start, start) < 0 {
+			start = r.start
+		}
+		if bytes.Compare(r.end, end) > 0 {
+			end = r.end
+		}
+	}
+	wch := w.store.client.Watch(clientv3.WithRequireLeader(wctx), string(start),
+		clientv3.WithRange(string(end)), clientv3.WithRev(initial.Revision+1))
+
+	for resp := range wch {
+		if err := resp.Err(); err != nil {
+			if isAuthError(err) {
+				err = &AuthError{Err: err}
+			}
+			send(WatchEvent{Err: err})
+			return
+		}
+
+		if !w.apply(resp.Events) {
+			continue
+		}
+		model, err := w.snapshot()
+		if err != nil {
+			send(WatchEvent{Err: err})
+			return
+		}
+
+		changed := changedFields(prev, model, model.Type().Name())
+		if len(changed) == 0 {
+			continue
+		}
+		if !send(WatchEvent{
+			Model:    model.Addr().Interface(),
+			Changed:  changed,
+			Revision: resp.Header.Revision,
+		}) {
+			return
+		}
+		prev = model
+	}
+}
+
+// apply updates the key values of the watched ranges and reports whether
+// any of the events touched them
+func (w *watcher) apply(events []*clientv3.Event) bool {
+	touched := false
+	for _, ev := range events {
+		for i, r := range w.ranges {
+			if !r.contains(ev.Kv.Key) {
+				continue
+			}
+			touched = true
+
+			kvs := w.kvs[i]
+			j := sort.Search(len(kvs), func(j int) bool {
+				return bytes.Compare(kvs[j].Key, ev.Kv.Key) >= 0
+			})
+			found := j < len(kvs) && bytes.Equal(kvs[j].Key, ev.Kv.Key)
+
+			switch {
+			case ev.Type == mvccpb.DELETE && found:
+				kvs = append(kvs[:j], kvs[j+1:]...)
+			case ev.Type == mvccpb.PUT && found:
+				kvs[j] = ev.Kv
+			case ev.Type == mvccpb.PUT:
+				kvs = append(kvs, nil)
+				copy(kvs[j+1:], kvs[j:])
+				kvs[j] = ev.Kv
+			}
+			w.kvs[i] = kvs
+		}
+	}
+	return touched
+}
+
+// snapshot decodes the current key values into a fresh copy of the template
+// through the same callbacks used by Get
+func (w *watcher) snapshot() (reflect.Value, error) {
+	model := cloneValue(w.template)
+	_, callbacks, err := createStructGetOps(model, model.Type().Name(), w.pathvar, false, w.plan)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	if len(callbacks) != len(w.kvs) {
+		return reflect.Value{}, &Error{Kind: ErrInvalidModel, Err: fmt.Errorf("model changed while being watched")}
+	}
+
+	for i, kvs := range w.kvs {
+		resp := &etcdserverpb.ResponseOp{
+			Response: &etcdserverpb.ResponseOp_ResponseRange{
+				ResponseRange: &etcdserverpb.RangeResponse{Kvs: kvs, Count: int64(len(kvs))},
+			},
+		}
+		if err := callbacks[i](resp); err != nil {
+			return reflect.Value{}, err
+		}
+	}
+	return model, nil
+}
+
+// cloneValue returns an addressable copy of v. Structs and slices are copied
+// so that decoding into the copy never writes to memory shared with v
+func cloneValue(v reflect.Value) reflect.Value {
+	c := reflect.New(v.Type()).Elem()
+	switch v.Kind() {
+	case reflect.Struct:
+		// Unexported fields are copied as they are
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if c.Field(i).CanSet() {
+				c.Field(i).Set(cloneValue(v.Field(i)))
+			}
+		}
+	case reflect.Slice:
+		if !v.IsNil() {
+			s := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+			for i := 0; i < v.Len(); i++ {
+				s.Index(i).Set(cloneValue(v.Index(i)))
+			}
+			c.Set(s)
+		}
+	default:
+		c.Set(v)
+	}
+	return c
+}
+
+// changedFields returns the Go field paths of the tagged fields that differ
+// between prev and next. Every tagged field is reported when prev is invalid
+func changedFields(prev, next reflect.Value, fieldPath string) []string {
+	changed := []string{}
+	for i := 0; i < next.NumField(); i++ {
+		sf := next.Type().Field(i)
+		if _, ok := sf.Tag.Lookup(tagKey); !ok {
+			continue
+		}
+		fieldName := fieldPath + "." + sf.Name
+
+		var prevField reflect.Value
+		if prev.IsValid() {
+			prevField = prev.Field(i)
+		}
+		nextField := next.Field(i)
+
+		if nextField.Kind() == reflect.Struct && plainCodec(nextField.Type()) == nil {
+			changed = append(changed, changedFields(prevField, nextField, fieldName)...)
+			continue
+		}
+		if !prevField.IsValid() || !reflect.DeepEqual(prevField.Interface(), nextField.Interface()) {
+			changed = append(changed, fieldName)
+		}
+	}
+	return changed
+}
@@ -0,0 +1,102 @@
+package etcdclient
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+)
+
+func putEvent(key, value string) *clientv3.Event {
+	return &clientv3.Event{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte(key), Value: []byte(value)}}
+}
+
+func deleteEvent(key string) *clientv3.Event {
+	return &clientv3.Event{Type: mvccpb.DELETE, Kv: &mvccpb.KeyValue{Key: []byte(key)}}
+}
+
+func TestWatcherSnapshots(t *testing.T) {
+	model := TestModel3{
+		Name: GetString(),
+		IDs:  []*EtcdUuid{GetUuid()},
+	}
+	w, etcdOps, err := newWatcher(context.Background(), &store{}, reflect.ValueOf(model), map[string]string{"var": "sub"})
+	require.NoError(t, err)
+	require.Len(t, etcdOps, 2)
+	w.kvs = make([][]*mvccpb.KeyValue, len(etcdOps))
+
+	cases := []struct {
+		name            string
+		events          []*clientv3.Event
+		expectedTouched bool
+		expectedModel   TestModel3
+		expectedChanged []string
+	}{
+		{
+			name:            "set_name",
+			events:          []*clientv3.Event{putEvent("/path/test/sub/to/name", "first")},
+			expectedTouched: true,
+			expectedModel: TestModel3{
+				Name: SetString("first"),
+				IDs:  []*EtcdUuid{},
+			},
+			expectedChanged: []string{"TestModel3.Name"},
+		},
+		{
+			name: "append_slice",
+			events: []*clientv3.Event{
+				putEvent("/path/test/sub/to/slice/b", "00000000-0000-4000-8000-00000000000b"),
+				putEvent("/path/test/sub/to/slice/a", "00000000-0000-4000-8000-00000000000a"),
+			},
+			expectedTouched: true,
+			expectedModel: TestModel3{
+				Name: SetString("first"),
+				IDs:  []*EtcdUuid{SetUuid("00000000-0000-4000-8000-00000000000a"), SetUuid("00000000-0000-4000-8000-00000000000b")},
+			},
+			expectedChanged: []string{"TestModel3.IDs"},
+		},
+		{
+			name:            "unrelated_key",
+			events:          []*clientv3.Event{putEvent("/path/test/sub/to/other", "x")},
+			expectedTouched: false,
+			expectedModel: TestModel3{
+				Name: SetString("first"),
+				IDs:  []*EtcdUuid{SetUuid("00000000-0000-4000-8000-00000000000a"), SetUuid("00000000-0000-4000-8000-00000000000b")},
+			},
+			expectedChanged: []string{},
+		},
+		{
+			name: "delete_name_and_element",
+			events: []*clientv3.Event{
+				deleteEvent("/path/test/sub/to/name"),
+				deleteEvent("/path/test/sub/to/slice/a"),
+			},
+			expectedTouched: true,
+			expectedModel: TestModel3{
+				IDs: []*EtcdUuid{SetUuid("00000000-0000-4000-8000-00000000000b")},
+			},
+			expectedChanged: []string{"TestModel3.Name", "TestModel3.IDs"},
+		},
+	}
+
+	prev, err := w.snapshot()
+	require.NoError(t, err)
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedTouched, w.apply(tc.events))
+
+			next, err := w.snapshot()
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedModel, next.Interface())
+			assert.Equal(t, tc.expectedChanged, changedFields(prev, next, "TestModel3"))
+			prev = next
+		})
+	}
+
+	// The template keeps its Get sentinels
+	assert.True(t, w.template.Interface().(TestModel3).IDs[0].IsGet())
+}